@@ -0,0 +1,217 @@
+package redisgo
+
+import (
+	"context"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+	"sync"
+	"time"
+)
+
+// doBlocking 用于 BLPOP、XREADGROUP BLOCK 等阻塞命令，读超时为阻塞时间加上配置的 ReadTimeout，block 为 0 时不设置读超时
+// ctx 可以取消时命令在单独的连接上执行，取消时通过 CLIENT UNBLOCK 使命令立即返回，
+// 服务端低于 5.0、没有 CLIENT 权限或 UNBLOCK 失败时关闭这个连接，调用方总是立即得到 ctx.Err()
+func (r *Redisgo) doBlocking(ctx context.Context, block time.Duration, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if args, f, err = r.prefixCommand(cmd, args, f); err != nil {
+		return nil, err
+	}
+
+	ctx, span := r.telemetry.start(ctx, cmd, args)
+	defer func(start time.Time) {
+		r.telemetry.end(ctx, span, strings.ToUpper(cmd), start, err)
+	}(time.Now())
+
+	return r.processHooks(ctx, cmd, args, func(ctx context.Context, cmd string, args []interface{}) (interface{}, error) {
+		return r.execBlocking(ctx, block, cmd, f, args...)
+	})
+}
+
+func (r *Redisgo) execBlocking(ctx context.Context, block time.Duration, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
+	gen, err := r.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	// 阻塞命令的耗时取决于阻塞时间，只统计错误
+	defer func() {
+		r.breaker.done(gen, err, -1)
+	}()
+
+	var key string
+	if idx, _ := commandKeyIndexes(cmd, args); len(idx) > 0 {
+		key = keyString(args[idx[0]])
+	}
+	var timeout time.Duration
+	if block > 0 {
+		timeout = block + time.Duration(r.opts.ReadTimeout)*time.Millisecond
+	}
+
+	if ctx.Done() == nil {
+		client, err := r.conn(ctx, key)
+		if err != nil {
+			return nil, convertErr(err)
+		}
+		reply, err = redis.DoWithTimeout(client, timeout, cmd, args...)
+		client.Close()
+	} else {
+		reply, err = r.execCancelable(ctx, key, timeout, cmd, args...)
+		// 已经取到数据时仍然返回数据，避免取出的元素丢失
+		if reply == nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if f != nil {
+		reply, err = f(reply, err)
+	}
+	if err == redis.ErrNil {
+		err = nil
+	}
+	if _, ok := err.(redis.Error); err != nil && !ok {
+		return nil, convertErr(err)
+	}
+	return
+}
+
+// execCancelable ctx 取消时先尝试 CLIENT UNBLOCK，成功时连接可以继续使用，否则关闭连接使读取立即返回
+func (r *Redisgo) execCancelable(ctx context.Context, key string, timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	c, err := r.blockingConn(key)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if c.id == 0 || !r.unblock(c.addr, c.id) {
+				c.Close()
+			}
+		}
+	}()
+
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	// 等待 CLIENT UNBLOCK 完成后再放回连接，避免解除之后复用这个连接的命令
+	close(done)
+	wg.Wait()
+	r.blocking.put(c)
+	return reply, err
+}
+
+// blockingConn 返回 key 所在节点的阻塞命令连接，新建连接时查询一次 CLIENT ID
+func (r *Redisgo) blockingConn(key string) (*blockingConn, error) {
+	var addr string
+	pool := r.pool
+	if r.cluster != nil {
+		var err error
+		if addr, err = r.cluster.slotAddr(keySlot(key)); err != nil {
+			return nil, err
+		}
+		pool = r.cluster.pool(addr)
+	}
+
+	if c := r.blocking.get(addr, pool.TestOnBorrow); c != nil {
+		return c, nil
+	}
+	conn, err := pool.Dial()
+	if err != nil {
+		return nil, err
+	}
+	c := &blockingConn{Conn: conn, addr: addr}
+	// 服务端不支持或没有权限时 id 为 0，取消时只能关闭连接
+	if c.id, err = redis.Int64(conn.Do("CLIENT", "ID")); err != nil {
+		if _, ok := err.(redis.Error); !ok {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// unblock 通过 addr 节点的另一个连接解除 id 对应客户端的阻塞，返回是否成功
+func (r *Redisgo) unblock(addr string, id int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pool := r.pool
+	if r.cluster != nil {
+		pool = r.cluster.pool(addr)
+	}
+	client, err := pool.GetContext(ctx)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	n, err := redis.Int(redis.DoContext(client, ctx, "CLIENT", "UNBLOCK", id))
+	return err == nil && n == 1
+}
+
+// blockingConn 阻塞命令使用的连接，不经过 redis.Pool，ctx 取消时可以直接关闭
+type blockingConn struct {
+	redis.Conn
+	// addr 集群模式下连接的节点
+	addr string
+	// id CLIENT ID，为 0 时不能使用 CLIENT UNBLOCK
+	id       int64
+	idleFrom time.Time
+}
+
+// blockingConns 按节点缓存空闲的阻塞命令连接，每个节点最多 max 个
+type blockingConns struct {
+	mu     sync.Mutex
+	idle   map[string][]*blockingConn
+	max    int
+	closed bool
+}
+
+// get 返回一个空闲连接，test 为对应连接池的 TestOnBorrow，没有可用连接时返回 nil
+func (p *blockingConns) get(addr string, test func(redis.Conn, time.Time) error) *blockingConn {
+	for {
+		p.mu.Lock()
+		conns := p.idle[addr]
+		if len(conns) == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		c := conns[len(conns)-1]
+		p.idle[addr] = conns[:len(conns)-1]
+		p.mu.Unlock()
+
+		if test == nil || test(c.Conn, c.idleFrom) == nil {
+			return c
+		}
+		c.Close()
+	}
+}
+
+func (p *blockingConns) put(c *blockingConn) {
+	if c.Err() != nil {
+		c.Close()
+		return
+	}
+	p.mu.Lock()
+	if p.closed || len(p.idle[c.addr]) >= p.max {
+		p.mu.Unlock()
+		c.Close()
+		return
+	}
+	c.idleFrom = time.Now()
+	p.idle[c.addr] = append(p.idle[c.addr], c)
+	p.mu.Unlock()
+}
+
+func (p *blockingConns) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for addr, conns := range p.idle {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(p.idle, addr)
+	}
+}
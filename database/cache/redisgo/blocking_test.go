@@ -0,0 +1,119 @@
+package redisgo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer 按 reply 应答命令，reply 返回空字符串的命令永远不返回，用于模拟一直阻塞的 BLPOP
+type fakeServer struct {
+	ln    net.Listener
+	reply func(args []string) string
+}
+
+func newFakeServer(t *testing.T, reply func(args []string) string) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, reply: reply}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		if resp := s.reply(args); resp != "" {
+			fmt.Fprint(c, resp)
+		}
+	}
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestBlockingCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		client func(sub string) string
+	}{
+		{"client id unsupported", func(string) string { return "-ERR unknown command 'CLIENT'\r\n" }},
+		{"unblock denied", func(sub string) string {
+			if sub == "ID" {
+				return ":7\r\n"
+			}
+			return "-NOPERM this user has no permissions to run the 'client|unblock' command\r\n"
+		}},
+		{"unblock not blocked", func(sub string) string {
+			if sub == "ID" {
+				return ":7\r\n"
+			}
+			return ":0\r\n"
+		}},
+	}
+	for _, tt := range tests {
+		// 只应答 CLIENT ID 和 CLIENT UNBLOCK
+		client := tt.client
+		s := newFakeServer(t, func(args []string) string {
+			if strings.EqualFold(args[0], "CLIENT") && len(args) > 1 {
+				return client(strings.ToUpper(args[1]))
+			}
+			return ""
+		})
+		r := NewRedisgo(WithAddr(s.ln.Addr().String()))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		_, _, err := r.BLPop(ctx, 0, "k")
+		if err != context.Canceled {
+			t.Errorf("%s: got %v, want context.Canceled", tt.name, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: returned after %v", tt.name, d)
+		}
+		// 关闭的连接不会被复用
+		if n := len(r.blocking.idle[""]); n != 0 {
+			t.Errorf("%s: %d idle blocking conns", tt.name, n)
+		}
+		r.Close()
+	}
+}
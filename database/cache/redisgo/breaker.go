@@ -0,0 +1,299 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	// BreakerClosed 正常放行所有请求
+	BreakerClosed BreakerState = iota
+	// BreakerOpen 直接返回 ErrCircuitOpen，不访问 redis
+	BreakerOpen
+	// BreakerHalfOpen 只放行少量探测请求，全部成功后关闭，任一失败重新打开
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText 健康检查接口输出 JSON 时使用状态名称
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CircuitBreaker 熔断配置，按滑动窗口内的错误率和慢请求比例打开熔断
+// 集群模式下所有节点共用一个熔断器
+type CircuitBreaker struct {
+	// Window 统计窗口，默认 10 秒
+	Window time.Duration
+	// Buckets 窗口划分的桶数，过期的桶整体丢弃，默认 10
+	Buckets int
+	// MinRequests 窗口内的请求数达到该值后才判断是否熔断，默认 20
+	MinRequests int
+	// ErrorRate 错误率达到该值时打开熔断，默认 0.5
+	ErrorRate float64
+	// SlowThreshold 耗时超过该值的请求记为慢请求，为 0 时不统计
+	SlowThreshold time.Duration
+	// SlowRate 慢请求比例达到该值时打开熔断，为 0 时不按耗时熔断
+	SlowRate float64
+	// OpenTimeout 打开后经过该时间进入半开状态，默认 5 秒
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态下放行的探测请求数，默认 1
+	HalfOpenRequests int
+	// OnStateChange 状态变化时调用，可用于记录日志或告警，不能阻塞
+	OnStateChange func(from, to BreakerState)
+}
+
+// BreakerStats 熔断器当前状态和窗口内的统计，用于健康检查
+type BreakerStats struct {
+	State     BreakerState `json:"state"`
+	Requests  int          `json:"requests"`
+	Failures  int          `json:"failures"`
+	Slow      int          `json:"slow"`
+	ErrorRate float64      `json:"error_rate"`
+	SlowRate  float64      `json:"slow_rate"`
+	// Rejected 累计因熔断被拒绝的请求数
+	Rejected uint64 `json:"rejected"`
+	// Since 进入当前状态的时间
+	Since time.Time `json:"since"`
+}
+
+type breakerBucket struct {
+	epoch    int64
+	requests int
+	failures int
+	slow     int
+}
+
+type circuitBreaker struct {
+	cfg    CircuitBreaker
+	bucket time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	since    time.Time
+	buckets  []breakerBucket
+	rejected uint64
+	// gen 每次状态变化时加一，忽略状态变化之前放行的请求的结果
+	gen       uint64
+	probes    int
+	successes int
+}
+
+func newCircuitBreaker(cfg *CircuitBreaker) *circuitBreaker {
+	if cfg == nil {
+		return nil
+	}
+	c := *cfg
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = 10
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.ErrorRate <= 0 {
+		c.ErrorRate = 0.5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 5 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	b := &circuitBreaker{
+		cfg:     c,
+		bucket:  c.Window / time.Duration(c.Buckets),
+		now:     time.Now,
+		buckets: make([]breakerBucket, c.Buckets),
+	}
+	if b.bucket <= 0 {
+		b.bucket = time.Millisecond
+	}
+	b.since = b.now()
+	return b
+}
+
+// allow 判断请求是否可以执行，可以执行时返回的 gen 需要传给 done
+// 未配置熔断时 b 为 nil，始终放行
+func (b *circuitBreaker) allow() (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	from, to := b.refresh(b.now())
+	gen, err := b.gen, error(nil)
+	switch b.state {
+	case BreakerOpen:
+		b.rejected++
+		err = ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			b.rejected++
+			err = ErrCircuitOpen
+		} else {
+			b.probes++
+		}
+	}
+	b.mu.Unlock()
+	b.notify(from, to)
+	return gen, err
+}
+
+// done 记录请求的结果，d 小于 0 时不统计耗时，用于阻塞命令
+func (b *circuitBreaker) done(gen uint64, err error, d time.Duration) {
+	if b == nil {
+		return
+	}
+	failed := isBreakerFailure(err)
+	slow := d >= 0 && b.cfg.SlowThreshold > 0 && d >= b.cfg.SlowThreshold
+
+	b.mu.Lock()
+	now := b.now()
+	from, to := b.refresh(now)
+	if gen == b.gen {
+		switch b.state {
+		case BreakerClosed:
+			bucket := b.current(now)
+			bucket.requests++
+			if failed {
+				bucket.failures++
+			}
+			if slow {
+				bucket.slow++
+			}
+			if b.tripped(now) {
+				from, to = b.setState(BreakerOpen, now)
+			}
+		case BreakerHalfOpen:
+			if failed || slow {
+				from, to = b.setState(BreakerOpen, now)
+				break
+			}
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenRequests {
+				from, to = b.setState(BreakerClosed, now)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *circuitBreaker) stats() BreakerStats {
+	if b == nil {
+		return BreakerStats{State: BreakerClosed}
+	}
+	b.mu.Lock()
+	now := b.now()
+	from, to := b.refresh(now)
+	s := BreakerStats{State: b.state, Rejected: b.rejected, Since: b.since}
+	s.Requests, s.Failures, s.Slow = b.sum(now)
+	b.mu.Unlock()
+	b.notify(from, to)
+
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Failures) / float64(s.Requests)
+		s.SlowRate = float64(s.Slow) / float64(s.Requests)
+	}
+	return s
+}
+
+// refresh 打开时间超过 OpenTimeout 后进入半开状态，需要持有锁
+func (b *circuitBreaker) refresh(now time.Time) (from, to BreakerState) {
+	if b.state == BreakerOpen && now.Sub(b.since) >= b.cfg.OpenTimeout {
+		return b.setState(BreakerHalfOpen, now)
+	}
+	return b.state, b.state
+}
+
+// setState 切换状态并清空统计，需要持有锁
+func (b *circuitBreaker) setState(state BreakerState, now time.Time) (from, to BreakerState) {
+	from = b.state
+	b.state = state
+	b.since = now
+	b.gen++
+	b.probes = 0
+	b.successes = 0
+	for i := range b.buckets {
+		b.buckets[i] = breakerBucket{}
+	}
+	return from, state
+}
+
+func (b *circuitBreaker) notify(from, to BreakerState) {
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
+
+// current 返回当前时间所在的桶，桶已过期时先清空
+func (b *circuitBreaker) current(now time.Time) *breakerBucket {
+	epoch := now.UnixNano() / int64(b.bucket)
+	bucket := &b.buckets[epoch%int64(len(b.buckets))]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+	return bucket
+}
+
+// sum 统计窗口内未过期的桶
+func (b *circuitBreaker) sum(now time.Time) (requests, failures, slow int) {
+	epoch := now.UnixNano() / int64(b.bucket)
+	for _, bucket := range b.buckets {
+		if bucket.epoch > epoch-int64(len(b.buckets)) {
+			requests += bucket.requests
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+	return
+}
+
+func (b *circuitBreaker) tripped(now time.Time) bool {
+	requests, failures, slow := b.sum(now)
+	if requests < b.cfg.MinRequests {
+		return false
+	}
+	if float64(failures)/float64(requests) >= b.cfg.ErrorRate {
+		return true
+	}
+	return b.cfg.SlowRate > 0 && float64(slow)/float64(requests) >= b.cfg.SlowRate
+}
+
+// isBreakerFailure 连接错误、超时和服务端不可用(LOADING、CLUSTERDOWN 等)计为失败
+// 调用方取消和 WRONGTYPE 这类命令本身的错误说明 redis 仍然可用，不计为失败
+func isBreakerFailure(err error) bool {
+	if err == nil || err == redis.ErrNil || err == ErrCircuitOpen || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if _, ok := err.(redis.Error); ok {
+		return classifyError(err) == retryAlways
+	}
+	return true
+}
+
+// BreakerStats 返回熔断器的状态，未配置熔断时始终为 BreakerClosed
+func (r *Redisgo) BreakerStats() BreakerStats {
+	return r.breaker.stats()
+}
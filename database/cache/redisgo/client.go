@@ -0,0 +1,98 @@
+package redisgo
+
+import (
+	"context"
+	"time"
+)
+
+// Client command.go 中封装的命令，业务代码依赖 Client 而不是 *Redisgo 时，
+// 单元测试可以使用 MemoryClient 代替真实的 redis
+type Client interface {
+	Close() error
+	DoCtx(ctx context.Context, cmd string, args ...interface{}) (interface{}, error)
+
+	TTL(ctx context.Context, key string) (int64, error)
+	Expire(ctx context.Context, key string, expire time.Duration) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, args ...interface{}) (int, error)
+
+	// string
+	Set(ctx context.Context, key, value interface{}) (bool, error)
+	SetNX(ctx context.Context, key string, value interface{}) (int, error)
+	SetNEX(ctx context.Context, key string, value interface{}, sec int) (bool, error)
+	SetExSecond(ctx context.Context, key, value interface{}, dur int) (string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	GetString(ctx context.Context, key string) (string, error)
+	GetFloat64(ctx context.Context, key string) (float64, error)
+	GetInt(ctx context.Context, key string) (int, error)
+	GetInt64(ctx context.Context, key string) (int64, error)
+	MGet(ctx context.Context, keys ...interface{}) ([][]byte, error)
+	MSet(ctx context.Context, keys ...interface{}) (string, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	Incrby(ctx context.Context, key string, incr int) (int64, error)
+
+	// list
+	LPush(ctx context.Context, name string, fields ...interface{}) error
+	Send(ctx context.Context, name string, fields ...interface{}) error
+	RPop(ctx context.Context, key string) (string, error)
+	LLen(ctx context.Context, key string) (int64, error)
+	BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error)
+	BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error)
+
+	// hash
+	HDel(ctx context.Context, key interface{}, fields ...interface{}) (int, error)
+	HSet(ctx context.Context, key, fieldk string, fieldv interface{}) (int, error)
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetFloat(ctx context.Context, key, field string) (float64, error)
+	HGetBytes(ctx context.Context, key, field string) ([]byte, error)
+	HGetInt(ctx context.Context, key, field string) (int, error)
+	HGetUint64(ctx context.Context, key, field string) (uint64, error)
+	HExists(ctx context.Context, key, field string) (bool, error)
+	HMGet(ctx context.Context, key string, fields ...interface{}) ([]string, error)
+	HMSet(ctx context.Context, key string, fields ...interface{}) (string, error)
+	HMSetStruct(ctx context.Context, key string, model interface{}) (string, error)
+	HGetStruct(ctx context.Context, key string, model interface{}) error
+	HGetStructSlice(ctx context.Context, key string, model interface{}) error
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HKeys(ctx context.Context, key string) ([]string, error)
+	HIncrby(ctx context.Context, key, field string, incr int) (int64, error)
+	HIncrbyFloat(ctx context.Context, key, field string, incr float64) (float64, error)
+
+	// set
+	SAdd(ctx context.Context, key string, members ...interface{}) (int, error)
+	SRem(ctx context.Context, key string, members ...interface{}) (int, error)
+	SIsMember(ctx context.Context, key string, member string) (bool, error)
+	SCard(ctx context.Context, key string) (int64, error)
+	SMembers(ctx context.Context, key string) ([]string, error)
+
+	// sorted set
+	ZAdd(ctx context.Context, key string, args ...interface{}) (int, error)
+	ZRange(ctx context.Context, key string, args ...interface{}) ([]string, error)
+	ZRangeInt(ctx context.Context, key string, start, stop int) ([]int, error)
+	ZRangeWithScore(ctx context.Context, key string, start, stop int) ([]string, error)
+	ZRevRangeWithScore(ctx context.Context, key string, start, stop int) ([]string, error)
+	ZCount(ctx context.Context, key string, min, max int64) (int, error)
+	ZCard(ctx context.Context, key string) (int, error)
+	ZIncrby(ctx context.Context, key string, incr int, member string) (int, error)
+	ZRank(ctx context.Context, key string, member string) (int, error)
+	ZRem(ctx context.Context, key string, members ...interface{}) (int, error)
+	ZRemrangebyrank(ctx context.Context, key string, members ...interface{}) (int, error)
+	ZScore(ctx context.Context, key, member string) (float64, error)
+	Zrevrange(ctx context.Context, key string, args ...interface{}) ([]string, error)
+	Zrevrangebyscore(ctx context.Context, key string, args ...interface{}) ([]string, error)
+	ZrevrangebyscoreInt(ctx context.Context, key string, args ...interface{}) ([]int, error)
+	BZPopMin(ctx context.Context, timeout time.Duration, keys ...string) (key, member string, score float64, err error)
+}
+
+var _ Client = (*Redisgo)(nil)
+
+// commander 执行单个命令，Redisgo 和 MemoryClient 都实现了这两个方法
+type commander interface {
+	do(ctx context.Context, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (interface{}, error)
+	doBlocking(ctx context.Context, block time.Duration, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (interface{}, error)
+}
+
+// commands command.go 中封装的命令，嵌入 Redisgo 和 MemoryClient，两者对返回值和 nil 的处理完全相同
+type commands struct {
+	commander
+}
@@ -0,0 +1,439 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clusterSlots        = 16384
+	clusterMaxRedirects = 5
+	// 两次拓扑刷新的最小间隔
+	clusterRefreshInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrCrossSlot 集群模式下多个 key 不在同一个 slot，与服务端返回的错误一致
+	ErrCrossSlot = redis.Error("CROSSSLOT Keys in request don't hash to the same slot")
+
+	ErrClusterNoNodes     = errors.New("redis: no cluster nodes available")
+	ErrClusterRedirects   = errors.New("redis: too many cluster redirections")
+	ErrClusterNeedKeySlot = errors.New("redis: cluster transaction requires watch keys")
+)
+
+// cluster 维护 slot 到节点的映射，每个节点一个连接池
+type cluster struct {
+	newPool func(addr string) *redis.Pool
+
+	mu       sync.RWMutex
+	slots    []string
+	nodeList []string
+	pools    map[string]*redis.Pool
+	seeds    []string
+
+	refreshing  int32
+	lastRefresh int64
+}
+
+func newCluster(seeds []string, newPool func(addr string) *redis.Pool) *cluster {
+	c := &cluster{
+		newPool: newPool,
+		slots:   make([]string, clusterSlots),
+		pools:   make(map[string]*redis.Pool),
+		seeds:   append([]string(nil), seeds...),
+	}
+	// 启动时获取失败不影响创建，第一次执行命令时会再次刷新
+	c.refresh()
+	return c
+}
+
+// pool 返回节点的连接池，不存在时创建
+func (c *cluster) pool(addr string) *redis.Pool {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok = c.pools[addr]; ok {
+		return p
+	}
+	p = c.newPool(addr)
+	c.pools[addr] = p
+	return p
+}
+
+func (c *cluster) nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.nodeList...)
+}
+
+// masters 返回当前负责 slot 的全部节点，拓扑未知时返回种子节点
+func (c *cluster) masters() []string {
+	if nodes := c.nodes(); len(nodes) > 0 {
+		return nodes
+	}
+	return append([]string(nil), c.seeds...)
+}
+
+// refresh 通过 CLUSTER SLOTS 重建 slot 映射
+func (c *cluster) refresh() error {
+	c.mu.RLock()
+	candidates := append([]string(nil), c.seeds...)
+	c.mu.RUnlock()
+	candidates = append(c.nodes(), candidates...)
+	atomic.StoreInt64(&c.lastRefresh, time.Now().UnixNano())
+
+	var lastErr error = ErrClusterNoNodes
+	for _, addr := range candidates {
+		slots, err := c.clusterSlots(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		seen := make(map[string]struct{})
+		var nodes []string
+		for _, a := range slots {
+			if _, ok := seen[a]; a != "" && !ok {
+				seen[a] = struct{}{}
+				nodes = append(nodes, a)
+			}
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.nodeList = nodes
+		c.mu.Unlock()
+		return nil
+	}
+	return lastErr
+}
+
+func (c *cluster) clusterSlots(addr string) ([]string, error) {
+	conn := c.pool(addr).Get()
+	defer conn.Close()
+
+	values, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	slots := make([]string, clusterSlots)
+	for _, v := range values {
+		entry, err := redis.Values(v, nil)
+		if err != nil || len(entry) < 3 {
+			continue
+		}
+		start, _ := redis.Int(entry[0], nil)
+		end, _ := redis.Int(entry[1], nil)
+		node, err := redis.Values(entry[2], nil)
+		if err != nil || len(node) < 2 {
+			continue
+		}
+		ip, _ := redis.String(node[0], nil)
+		port, _ := redis.Int(node[1], nil)
+		// 节点未配置对外地址时返回空字符串，使用查询的节点地址
+		if ip == "" {
+			ip = host
+		}
+		master := net.JoinHostPort(ip, strconv.Itoa(port))
+		for s := start; s <= end && s < clusterSlots; s++ {
+			slots[s] = master
+		}
+	}
+	return slots, nil
+}
+
+// lazyRefresh 异步刷新拓扑，避免大量请求同时刷新
+func (c *cluster) lazyRefresh() {
+	if time.Now().UnixNano()-atomic.LoadInt64(&c.lastRefresh) < int64(clusterRefreshInterval) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.refresh()
+	}()
+}
+
+func (c *cluster) setSlot(slot int, addr string) {
+	if slot < 0 || slot >= clusterSlots {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slots[slot] = addr
+	for _, a := range c.nodeList {
+		if a == addr {
+			return
+		}
+	}
+	c.nodeList = append(c.nodeList, addr)
+}
+
+// slotAddr 返回负责 slot 的节点，slot 小于 0 或映射未知时随机选择一个节点
+func (c *cluster) slotAddr(slot int) (string, error) {
+	if slot >= 0 {
+		c.mu.RLock()
+		addr := c.slots[slot]
+		c.mu.RUnlock()
+		if addr != "" {
+			return addr, nil
+		}
+		c.lazyRefresh()
+	}
+	masters := c.masters()
+	if len(masters) == 0 {
+		return "", ErrClusterNoNodes
+	}
+	return masters[rand.Intn(len(masters))], nil
+}
+
+// commandSlot 返回命令所在的 slot，命令不包含 key 时返回 -1，多个 key 不在同一个 slot 时返回 ErrCrossSlot
+func commandSlot(cmd string, args []interface{}) (int, error) {
+	slot := -1
+	idx, _ := commandKeyIndexes(cmd, args)
+	for _, i := range idx {
+		s := keySlot(keyString(args[i]))
+		if slot >= 0 && s != slot {
+			return -1, ErrCrossSlot
+		}
+		slot = s
+	}
+	return slot, nil
+}
+
+// do 在 key 所在的节点执行命令，并处理 MOVED/ASK 重定向
+func (c *cluster) do(ctx context.Context, cmd string, args []interface{}) (interface{}, error) {
+	slot, err := commandSlot(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := c.slotAddr(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	asking := false
+	for i := 0; i <= clusterMaxRedirects; i++ {
+		client, err := c.pool(addr).GetContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if asking {
+			client.Send("ASKING")
+		}
+		setPeer(ctx, addr)
+		reply, err := doContext(ctx, client, cmd, args...)
+		client.Close()
+
+		if e, ok := err.(redis.Error); ok {
+			if kind, s, target, ok := parseRedirect(e); ok {
+				if kind == "MOVED" {
+					c.setSlot(s, target)
+					c.lazyRefresh()
+					asking = false
+				} else {
+					asking = true
+				}
+				addr = target
+				continue
+			}
+			if strings.HasPrefix(string(e), "CLUSTERDOWN") || strings.HasPrefix(string(e), "TRYAGAIN") {
+				c.lazyRefresh()
+			}
+		} else if err != nil && err != redis.ErrNil && ctx.Err() == nil {
+			// 连接失败可能是节点下线，刷新拓扑以便重试时找到新的主节点
+			c.lazyRefresh()
+		}
+		return reply, err
+	}
+	return nil, ErrClusterRedirects
+}
+
+// conn 返回 key 所在节点的连接，用于事务等需要固定连接的场景
+func (c *cluster) conn(ctx context.Context, key string) (redis.Conn, error) {
+	addr, err := c.slotAddr(keySlot(key))
+	if err != nil {
+		return nil, err
+	}
+	return c.pool(addr).GetContext(ctx)
+}
+
+func (c *cluster) dial() (redis.Conn, error) {
+	addr, err := c.slotAddr(-1)
+	if err != nil {
+		return nil, err
+	}
+	return c.pool(addr).Dial()
+}
+
+func (c *cluster) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for _, p := range c.pools {
+		if e := p.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// parseRedirect 解析 "MOVED 3999 127.0.0.1:6381" 或 "ASK 3999 127.0.0.1:6381"
+func parseRedirect(e redis.Error) (kind string, slot int, addr string, ok bool) {
+	parts := strings.Fields(string(e))
+	if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+		return
+	}
+	slot, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+	return parts[0], slot, parts[2], true
+}
+
+// keySlot 计算 key 所在的 slot，支持 {hash tag}
+func keySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 CRC16-CCITT (XMODEM)
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// groupBySlot 将 key 按加上前缀之后的 slot 分组，返回每个 slot 中 key 在原参数中的下标
+func groupBySlot(prefix string, keys []interface{}) map[int][]int {
+	groups := make(map[int][]int)
+	for i, k := range keys {
+		s := keySlot(prefix + keyString(k))
+		groups[s] = append(groups[s], i)
+	}
+	return groups
+}
+
+// clusterMGet 按 slot 拆分 MGET，结果顺序与 keys 一致
+func (r *Redisgo) clusterMGet(ctx context.Context, keys ...interface{}) ([][]byte, error) {
+	ret := make([][]byte, len(keys))
+	for _, idx := range groupBySlot(r.prefix, keys) {
+		args := make([]interface{}, 0, len(idx))
+		for _, i := range idx {
+			args = append(args, keys[i])
+		}
+		reply, err := r.do(ctx, "MGET", redisByteSlices, args...)
+		if err != nil {
+			return nil, err
+		}
+		values := reply.([][]byte)
+		for j, i := range idx {
+			if j < len(values) {
+				ret[i] = values[j]
+			}
+		}
+	}
+	return ret, nil
+}
+
+// clusterDel 按 slot 拆分 DEL，返回删除的总数
+func (r *Redisgo) clusterDel(ctx context.Context, keys ...interface{}) (int, error) {
+	count := 0
+	for _, idx := range groupBySlot(r.prefix, keys) {
+		args := make([]interface{}, 0, len(idx))
+		for _, i := range idx {
+			args = append(args, keys[i])
+		}
+		reply, err := r.do(ctx, "DEL", redisInt, args...)
+		if err != nil {
+			return count, err
+		}
+		count += reply.(int)
+	}
+	return count, nil
+}
+
+// clusterExecPipeline 按节点拆分管道，重定向的命令单独在新的节点上重新执行
+func (r *Redisgo) clusterExecPipeline(ctx context.Context, cmds []*pipeCmd) error {
+	groups := make(map[string][]*pipeCmd)
+	for _, c := range cmds {
+		slot, err := commandSlot(c.name, c.args)
+		if err != nil {
+			c.err = err
+			continue
+		}
+		addr, err := r.cluster.slotAddr(slot)
+		if err != nil {
+			c.err = err
+			continue
+		}
+		groups[addr] = append(groups[addr], c)
+	}
+
+	for addr, group := range groups {
+		client, err := r.cluster.pool(addr).GetContext(ctx)
+		if err != nil {
+			setCmdsErr(group, convertErr(err))
+			continue
+		}
+		err = sendPipeline(ctx, client, group)
+		client.Close()
+		if err != nil {
+			setCmdsErr(group, convertErr(err))
+			continue
+		}
+
+		for _, c := range group {
+			if e, ok := c.err.(redis.Error); ok {
+				if _, _, _, ok := parseRedirect(e); ok {
+					// 参数已经在 execPipeline 中加过前缀，不能再经过 r.do
+					reply, err := r.cluster.do(ctx, c.name, c.args)
+					if c.f != nil {
+						reply, err = c.f(reply, err)
+					}
+					if err == redis.ErrNil {
+						err = nil
+					}
+					c.reply, c.err = reply, err
+				}
+			}
+		}
+	}
+
+	for _, c := range cmds {
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return nil
+}
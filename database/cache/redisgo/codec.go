@@ -0,0 +1,179 @@
+package redisgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"time"
+)
+
+var (
+	ErrNotProtoMessage = errors.New("redis: value is not a proto.Message")
+)
+
+// Codec 缓存值的序列化方式
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = MsgpackCodec{}
+	_ Codec = GobCodec{}
+	_ Codec = ProtoCodec{}
+)
+
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// GobCodec 接口类型的字段需要先通过 gob.Register 注册具体类型
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ProtoCodec 值必须实现 proto.Message，GetT 等泛型函数中 T 应为消息的指针类型
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+
+	// *T 且 T 为消息指针时，为 T 分配内存
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok := rv.Elem().Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return ErrNotProtoMessage
+}
+
+// codec 返回配置的序列化方式，默认为 JSON
+func (r *Redisgo) codec() Codec {
+	if r.opts.Codec != nil {
+		return r.opts.Codec
+	}
+	return JSONCodec{}
+}
+
+// GetT 读取 key 并反序列化为 T，key 不存在时返回 ErrKeyNoExist
+func GetT[T any](ctx context.Context, r *Redisgo, key string) (res T, err error) {
+	data, err := r.Get(ctx, key)
+	if err != nil {
+		return
+	}
+	if data == nil {
+		return res, ErrKeyNoExist
+	}
+	err = r.codec().Unmarshal(data, &res)
+	return
+}
+
+// SetT 序列化 value 后写入 key，ttl 为 0 时不过期
+func SetT[T any](ctx context.Context, r *Redisgo, key string, value T, ttl time.Duration) error {
+	data, err := r.codec().Marshal(value)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{key, data}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err = r.do(ctx, "SET", nil, args...)
+	return err
+}
+
+// MGetT 批量读取并反序列化，不存在的 key 不会出现在返回的 map 中
+func MGetT[T any](ctx context.Context, r *Redisgo, keys ...string) (map[string]T, error) {
+	args := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	values, err := r.MGet(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]T, len(keys))
+	codec := r.codec()
+	for i, data := range values {
+		if data == nil || i >= len(keys) {
+			continue
+		}
+		var v T
+		if err := codec.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		res[keys[i]] = v
+	}
+	return res, nil
+}
+
+// HGetT 读取 hash 的 field 并反序列化为 T，key 或 field 不存在时返回 ErrKeyNoExist
+func HGetT[T any](ctx context.Context, r *Redisgo, key, field string) (res T, err error) {
+	data, err := r.HGetBytes(ctx, key, field)
+	if err == redis.ErrNil || (err == nil && data == nil) {
+		return res, ErrKeyNoExist
+	}
+	if err != nil {
+		return
+	}
+	err = r.codec().Unmarshal(data, &res)
+	return
+}
+
+// HSetT 序列化 value 后写入 hash 的 field
+func HSetT[T any](ctx context.Context, r *Redisgo, key, field string, value T) error {
+	data, err := r.codec().Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = r.HSet(ctx, key, field, data)
+	return err
+}
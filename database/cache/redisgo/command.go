@@ -3,18 +3,33 @@ package redisgo
 import (
 	"context"
 	"github.com/gomodule/redigo/redis"
+	"strconv"
 	"time"
 )
 
 func (r *Redisgo) Close() error {
+	if r.namespace {
+		return nil
+	}
+	r.telemetry.close()
+	r.blocking.close()
+	if r.sentinel != nil {
+		r.sentinel.close()
+	}
+	if r.cluster != nil {
+		return r.cluster.close()
+	}
+	if r.replicas != nil {
+		r.replicas.close()
+	}
 	return r.pool.Close()
 }
 
-func (r *Redisgo) TTL(ctx context.Context, key string) (res int64, err error) {
-	return redis.Int64(r.Do(ctx, "TTL", key))
+func (r commands) TTL(ctx context.Context, key string) (res int64, err error) {
+	return redis.Int64(r.do(ctx, "TTL", nil, key))
 }
 
-func (r *Redisgo) RPop(ctx context.Context, key string) (res string, err error) {
+func (r commands) RPop(ctx context.Context, key string) (res string, err error) {
 	reply, err := r.do(ctx, "RPOP", redisBytes, key)
 	if err != nil {
 		return "", err
@@ -22,42 +37,82 @@ func (r *Redisgo) RPop(ctx context.Context, key string) (res string, err error)
 	return string(reply.([]byte)[:]), nil
 }
 
-func (r *Redisgo) LPush(ctx context.Context, name string, fields ...interface{}) error {
+func (r commands) LPush(ctx context.Context, name string, fields ...interface{}) error {
 	keys := []interface{}{name}
 	keys = append(keys, fields...)
 	_, err := r.do(ctx, "LPUSH", nil, keys...)
 	return err
 }
 
-func (r *Redisgo) Send(ctx context.Context, name string, fields ...interface{}) error {
+func (r commands) Send(ctx context.Context, name string, fields ...interface{}) error {
 	keys := []interface{}{name}
 	keys = append(keys, fields...)
 	_, err := r.do(ctx, "RPUSH", nil, keys...)
 	return err
 }
 
-// DoCtx 函数与Do函数相比， 增加了一个context参数， 提供了超时的功能
-func (r *Redisgo) DoCtx(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
-	var (
-		ch    = make(chan struct{})
-		reply interface{}
-		err   error
-	)
-	go func() {
-		defer close(ch)
-		reply, err = r.do(ctx, cmd, nil, args...)
-	}()
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-ch:
-		return reply, err
+// blockTimeout 阻塞命令的超时参数，单位为秒，0 表示一直阻塞
+func blockTimeout(timeout time.Duration) string {
+	return strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)
+}
+
+// BLPop 从第一个非空列表的头部取出元素，所有列表都为空时最多阻塞 timeout，timeout 为 0 时一直阻塞直到 ctx 结束
+// 超时返回空字符串，ctx 结束返回 ctx.Err()
+func (r commands) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error) {
+	return r.blockingPop(ctx, "BLPOP", timeout, keys)
+}
+
+// BRPop 与 BLPop 相同，从列表尾部取出元素
+func (r commands) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, err error) {
+	return r.blockingPop(ctx, "BRPOP", timeout, keys)
+}
+
+func (r commands) blockingPop(ctx context.Context, cmd string, timeout time.Duration, keys []string) (key, value string, err error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	for _, k := range keys {
+		args = append(args, k)
 	}
+	args = append(args, blockTimeout(timeout))
+
+	var reply interface{}
+	reply, err = r.doBlocking(ctx, timeout, cmd, redisStrings, args...)
+	if err != nil {
+		return
+	}
+	if res := reply.([]string); len(res) == 2 {
+		key, value = res[0], res[1]
+	}
+	return
+}
+
+// BZPopMin 从第一个非空有序集合中取出分数最小的成员，阻塞规则与 BLPop 相同
+func (r commands) BZPopMin(ctx context.Context, timeout time.Duration, keys ...string) (key, member string, score float64, err error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	args = append(args, blockTimeout(timeout))
+
+	var reply interface{}
+	reply, err = r.doBlocking(ctx, timeout, "BZPOPMIN", redisStrings, args...)
+	if err != nil {
+		return
+	}
+	if res := reply.([]string); len(res) == 3 {
+		key, member = res[0], res[1]
+		score, err = strconv.ParseFloat(res[2], 64)
+	}
+	return
+}
+
+// DoCtx 与 do 相同，ctx 的截止时间作为读超时，ctx 取消时立即返回并关闭执行中的连接
+func (r commands) DoCtx(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return r.do(ctx, cmd, nil, args...)
 }
 
 // Set 返回两个参数，err不为空为服务器内服错误， 当命令执行成功时，ret为true
 // 使用这个函数时需要同时判断这两个返回值
-func (r *Redisgo) Set(ctx context.Context, key, value interface{}) (ret bool, err error) {
+func (r commands) Set(ctx context.Context, key, value interface{}) (ret bool, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "SET", redisString, key, value)
 	if err != nil {
@@ -74,20 +129,20 @@ func (r *Redisgo) Set(ctx context.Context, key, value interface{}) (ret bool, er
 }
 
 //不存在则设置，存在则不设置
-func (r *Redisgo) SetNX(ctx context.Context, key string, value interface{}) (num int, err error) {
-	num, err = redis.Int(r.Do(ctx, "SETNX", key, value))
+func (r commands) SetNX(ctx context.Context, key string, value interface{}) (num int, err error) {
+	num, err = redis.Int(r.do(ctx, "SETNX", nil, key, value))
 	return
 }
 
-func (r *Redisgo) SetNEX(ctx context.Context, key string, value interface{}, sec int) (bt bool, err error) {
-	_, err = redis.String(r.Do(ctx, "SET", key, value, "EX", sec, "NX"))
+func (r commands) SetNEX(ctx context.Context, key string, value interface{}, sec int) (bt bool, err error) {
+	_, err = redis.String(r.do(ctx, "SET", nil, key, value, "EX", sec, "NX"))
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func (r *Redisgo) SetExSecond(ctx context.Context, key, value interface{}, dur int) (ret string, err error) {
+func (r commands) SetExSecond(ctx context.Context, key, value interface{}, dur int) (ret string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "SET", redisString, key, value, "EX", dur)
 	if err != nil {
@@ -97,7 +152,7 @@ func (r *Redisgo) SetExSecond(ctx context.Context, key, value interface{}, dur i
 	return
 }
 
-func (r *Redisgo) Get(ctx context.Context, key string) (ret []byte, err error) {
+func (r commands) Get(ctx context.Context, key string) (ret []byte, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "GET", redisBytes, key)
 	if err != nil {
@@ -107,7 +162,7 @@ func (r *Redisgo) Get(ctx context.Context, key string) (ret []byte, err error) {
 	return
 }
 
-func (r *Redisgo) GetString(ctx context.Context, key string) (ret string, err error) {
+func (r commands) GetString(ctx context.Context, key string) (ret string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "GET", redisString, key)
 	if err != nil {
@@ -117,7 +172,7 @@ func (r *Redisgo) GetString(ctx context.Context, key string) (ret string, err er
 	return
 }
 
-func (r *Redisgo) GetFloat64(ctx context.Context, key string) (ret float64, err error) {
+func (r commands) GetFloat64(ctx context.Context, key string) (ret float64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "GET", redisFloat64, key)
 	if err != nil {
@@ -127,7 +182,7 @@ func (r *Redisgo) GetFloat64(ctx context.Context, key string) (ret float64, err
 	return
 }
 
-func (r *Redisgo) GetInt(ctx context.Context, key string) (ret int, err error) {
+func (r commands) GetInt(ctx context.Context, key string) (ret int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "GET", redisInt, key)
 	if err != nil {
@@ -137,7 +192,7 @@ func (r *Redisgo) GetInt(ctx context.Context, key string) (ret int, err error) {
 	return
 }
 
-func (r *Redisgo) GetInt64(ctx context.Context, key string) (ret int64, err error) {
+func (r commands) GetInt64(ctx context.Context, key string) (ret int64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "GET", redisInt64, key)
 	if err != nil {
@@ -147,7 +202,15 @@ func (r *Redisgo) GetInt64(ctx context.Context, key string) (ret int64, err erro
 	return
 }
 
+// MGet 集群模式下按 slot 拆分执行
 func (r *Redisgo) MGet(ctx context.Context, keys ...interface{}) (ret [][]byte, err error) {
+	if r.cluster != nil {
+		return r.clusterMGet(ctx, keys...)
+	}
+	return r.commands.MGet(ctx, keys...)
+}
+
+func (r commands) MGet(ctx context.Context, keys ...interface{}) (ret [][]byte, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "MGET", redisByteSlices, keys...)
 	if err != nil {
@@ -157,7 +220,7 @@ func (r *Redisgo) MGet(ctx context.Context, keys ...interface{}) (ret [][]byte,
 	return
 }
 
-func (r *Redisgo) MSet(ctx context.Context, keys ...interface{}) (ret string, err error) {
+func (r commands) MSet(ctx context.Context, keys ...interface{}) (ret string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "MSET", redisString, keys...)
 	if err != nil {
@@ -167,7 +230,15 @@ func (r *Redisgo) MSet(ctx context.Context, keys ...interface{}) (ret string, er
 	return
 }
 
+// Del 集群模式下按 slot 拆分执行，返回删除的总数
 func (r *Redisgo) Del(ctx context.Context, args ...interface{}) (count int, err error) {
+	if r.cluster != nil {
+		return r.clusterDel(ctx, args...)
+	}
+	return r.commands.Del(ctx, args...)
+}
+
+func (r commands) Del(ctx context.Context, args ...interface{}) (count int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "Del", redisInt, args...)
 	if err != nil {
@@ -177,7 +248,7 @@ func (r *Redisgo) Del(ctx context.Context, args ...interface{}) (count int, err
 	return
 }
 
-func (r *Redisgo) Exists(ctx context.Context, key string) (res bool, err error) {
+func (r commands) Exists(ctx context.Context, key string) (res bool, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "Exists", redisBool, key)
 	if err != nil {
@@ -187,7 +258,7 @@ func (r *Redisgo) Exists(ctx context.Context, key string) (res bool, err error)
 	return
 }
 
-func (r *Redisgo) Expire(ctx context.Context, key string, expire time.Duration) error {
+func (r commands) Expire(ctx context.Context, key string, expire time.Duration) error {
 	_, err := r.do(ctx, "EXPIRE", nil, key, int64(expire.Seconds()))
 	if err != nil {
 		return err
@@ -198,7 +269,7 @@ func (r *Redisgo) Expire(ctx context.Context, key string, expire time.Duration)
 /*
 *	hash
  */
-func (r *Redisgo) HDel(ctx context.Context, key interface{}, fields ...interface{}) (res int, err error) {
+func (r commands) HDel(ctx context.Context, key interface{}, fields ...interface{}) (res int, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, fields...)
@@ -211,7 +282,7 @@ func (r *Redisgo) HDel(ctx context.Context, key interface{}, fields ...interface
 	return
 }
 
-func (r *Redisgo) HSet(ctx context.Context, key, fieldk string, fieldv interface{}) (res int, err error) {
+func (r commands) HSet(ctx context.Context, key, fieldk string, fieldv interface{}) (res int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HSET", redisInt, key, fieldk, fieldv)
 	if err != nil {
@@ -221,7 +292,7 @@ func (r *Redisgo) HSet(ctx context.Context, key, fieldk string, fieldv interface
 	return
 }
 
-func (r *Redisgo) HGet(ctx context.Context, key, field string) (res string, err error) {
+func (r commands) HGet(ctx context.Context, key, field string) (res string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HGET", redisString, key, field)
 	if err != nil {
@@ -231,7 +302,7 @@ func (r *Redisgo) HGet(ctx context.Context, key, field string) (res string, err
 	return
 }
 
-func (r *Redisgo) HGetFloat(ctx context.Context, key, field string) (res float64, err error) {
+func (r commands) HGetFloat(ctx context.Context, key, field string) (res float64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HGET", redisFloat64, key, field)
 	if err != nil {
@@ -241,11 +312,11 @@ func (r *Redisgo) HGetFloat(ctx context.Context, key, field string) (res float64
 	return
 }
 
-func (r *Redisgo) HGetBytes(ctx context.Context, key, field string) ([]byte, error) {
-	return redis.Bytes(r.Do(ctx, "HGET", key, field))
+func (r commands) HGetBytes(ctx context.Context, key, field string) ([]byte, error) {
+	return redis.Bytes(r.do(ctx, "HGET", nil, key, field))
 }
 
-func (r *Redisgo) HGetInt(ctx context.Context, key, field string) (res int, err error) {
+func (r commands) HGetInt(ctx context.Context, key, field string) (res int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HGET", redisInt, key, field)
 	if err != nil {
@@ -255,19 +326,19 @@ func (r *Redisgo) HGetInt(ctx context.Context, key, field string) (res int, err
 	return
 }
 
-func (r *Redisgo) HGetUint64(ctx context.Context, key, field string) (res uint64, err error) {
-	return redis.Uint64(r.Do(ctx, "HGET", key, field))
+func (r commands) HGetUint64(ctx context.Context, key, field string) (res uint64, err error) {
+	return redis.Uint64(r.do(ctx, "HGET", nil, key, field))
 }
 
-func (r *Redisgo) HExists(ctx context.Context, key, field string) (res bool, err error) {
-	data, err := redis.Int(r.Do(ctx, "HEXISTS", key, field))
+func (r commands) HExists(ctx context.Context, key, field string) (res bool, err error) {
+	data, err := redis.Int(r.do(ctx, "HEXISTS", nil, key, field))
 	if err != nil {
 		return false, err
 	}
 	return data == 1, nil
 }
 
-func (r *Redisgo) HMGet(ctx context.Context, key string, fields ...interface{}) (res []string, err error) {
+func (r commands) HMGet(ctx context.Context, key string, fields ...interface{}) (res []string, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, fields...)
@@ -279,12 +350,12 @@ func (r *Redisgo) HMGet(ctx context.Context, key string, fields ...interface{})
 	return
 }
 
-func (r *Redisgo) HMSetStruct(ctx context.Context, key string, model interface{}) (string, error) {
-	return redis.String(r.Do(ctx, "HMSET", redis.Args{}.Add(key).AddFlat(model)...))
+func (r commands) HMSetStruct(ctx context.Context, key string, model interface{}) (string, error) {
+	return redis.String(r.do(ctx, "HMSET", nil, redis.Args{}.Add(key).AddFlat(model)...))
 }
 
-func (r *Redisgo) HGetStruct(ctx context.Context, key string, model interface{}) error {
-	value, err := redis.Values(r.Do(ctx, "HGETALL", key))
+func (r commands) HGetStruct(ctx context.Context, key string, model interface{}) error {
+	value, err := redis.Values(r.do(ctx, "HGETALL", nil, key))
 	if err != nil {
 		return err
 	}
@@ -294,8 +365,8 @@ func (r *Redisgo) HGetStruct(ctx context.Context, key string, model interface{})
 	return redis.ScanStruct(value, model)
 }
 
-func (r *Redisgo) HGetStructSlice(ctx context.Context, key string, model interface{}) error {
-	value, err := redis.Values(r.Do(ctx, "HGETALL", key))
+func (r commands) HGetStructSlice(ctx context.Context, key string, model interface{}) error {
+	value, err := redis.Values(r.do(ctx, "HGETALL", nil, key))
 	if err != nil {
 		return err
 	}
@@ -305,7 +376,7 @@ func (r *Redisgo) HGetStructSlice(ctx context.Context, key string, model interfa
 	return redis.ScanSlice(value, model)
 }
 
-func (r *Redisgo) HMSet(ctx context.Context, key string, fields ...interface{}) (res string, err error) {
+func (r commands) HMSet(ctx context.Context, key string, fields ...interface{}) (res string, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, fields...)
@@ -317,7 +388,7 @@ func (r *Redisgo) HMSet(ctx context.Context, key string, fields ...interface{})
 	return
 }
 
-func (r *Redisgo) HGetAll(ctx context.Context, key string) (res map[string]string, err error) {
+func (r commands) HGetAll(ctx context.Context, key string) (res map[string]string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HGETALL", redisStringMap, key)
 	if err != nil {
@@ -327,7 +398,7 @@ func (r *Redisgo) HGetAll(ctx context.Context, key string) (res map[string]strin
 	return
 }
 
-func (r *Redisgo) HKeys(ctx context.Context, key string) (res []string, err error) {
+func (r commands) HKeys(ctx context.Context, key string) (res []string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HKEYS", redisStrings, key)
 	if err != nil {
@@ -337,7 +408,7 @@ func (r *Redisgo) HKeys(ctx context.Context, key string) (res []string, err erro
 	return
 }
 
-func (r *Redisgo) HIncrby(ctx context.Context, key, field string, incr int) (res int64, err error) {
+func (r commands) HIncrby(ctx context.Context, key, field string, incr int) (res int64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "HINCRBY", redisInt64, key, field, incr)
 	if err != nil {
@@ -347,14 +418,14 @@ func (r *Redisgo) HIncrby(ctx context.Context, key, field string, incr int) (res
 	return
 }
 
-func (r *Redisgo) HIncrbyFloat(ctx context.Context, key, field string, incr float64) (res float64, err error) {
-	return redis.Float64(r.Do(ctx, "HINCRBYFLOAT", key, field, incr))
+func (r commands) HIncrbyFloat(ctx context.Context, key, field string, incr float64) (res float64, err error) {
+	return redis.Float64(r.do(ctx, "HINCRBYFLOAT", nil, key, field, incr))
 }
 
 /*
 *	set
  */
-func (r *Redisgo) SAdd(ctx context.Context, key string, members ...interface{}) (res int, err error) {
+func (r commands) SAdd(ctx context.Context, key string, members ...interface{}) (res int, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, members...)
@@ -366,7 +437,7 @@ func (r *Redisgo) SAdd(ctx context.Context, key string, members ...interface{})
 	return
 }
 
-func (r *Redisgo) SRem(ctx context.Context, key string, members ...interface{}) (res int, err error) {
+func (r commands) SRem(ctx context.Context, key string, members ...interface{}) (res int, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, members...)
@@ -378,7 +449,7 @@ func (r *Redisgo) SRem(ctx context.Context, key string, members ...interface{})
 	return
 }
 
-func (r *Redisgo) SIsMember(ctx context.Context, key string, member string) (res bool, err error) {
+func (r commands) SIsMember(ctx context.Context, key string, member string) (res bool, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "SISMEMBER", redisBool, key, member)
 	if err != nil {
@@ -389,7 +460,7 @@ func (r *Redisgo) SIsMember(ctx context.Context, key string, member string) (res
 	return
 }
 
-func (r *Redisgo) SCard(ctx context.Context, key string) (ret int64, err error) {
+func (r commands) SCard(ctx context.Context, key string) (ret int64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "SCARD", redisInt64, key)
 	if err != nil {
@@ -399,7 +470,7 @@ func (r *Redisgo) SCard(ctx context.Context, key string) (ret int64, err error)
 	return
 }
 
-func (r *Redisgo) SMembers(ctx context.Context, key string) (res []string, err error) {
+func (r commands) SMembers(ctx context.Context, key string) (res []string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "SMEMBERS", redisStrings, key)
 	if err != nil {
@@ -409,7 +480,7 @@ func (r *Redisgo) SMembers(ctx context.Context, key string) (res []string, err e
 	return
 }
 
-func (r *Redisgo) ZAdd(ctx context.Context, key string, args ...interface{}) (res int, err error) {
+func (r commands) ZAdd(ctx context.Context, key string, args ...interface{}) (res int, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, args...)
@@ -421,7 +492,7 @@ func (r *Redisgo) ZAdd(ctx context.Context, key string, args ...interface{}) (re
 	return
 }
 
-func (r *Redisgo) ZRange(ctx context.Context, key string, args ...interface{}) (res []string, err error) {
+func (r commands) ZRange(ctx context.Context, key string, args ...interface{}) (res []string, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, args...)
@@ -433,7 +504,7 @@ func (r *Redisgo) ZRange(ctx context.Context, key string, args ...interface{}) (
 	return
 }
 
-func (r *Redisgo) ZRangeInt(ctx context.Context, key string, start, stop int) (res []int, err error) {
+func (r commands) ZRangeInt(ctx context.Context, key string, start, stop int) (res []int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZRANGE", redisInts, key, start, stop)
 	if err != nil {
@@ -443,7 +514,7 @@ func (r *Redisgo) ZRangeInt(ctx context.Context, key string, start, stop int) (r
 	return
 }
 
-func (r *Redisgo) ZRangeWithScore(ctx context.Context, key string, start, stop int) (res []string, err error) {
+func (r commands) ZRangeWithScore(ctx context.Context, key string, start, stop int) (res []string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZRANGE", redisStrings, key, start, stop, "WITHSCORES")
 	if err != nil {
@@ -453,7 +524,7 @@ func (r *Redisgo) ZRangeWithScore(ctx context.Context, key string, start, stop i
 	return
 }
 
-func (r *Redisgo) ZRevRangeWithScore(ctx context.Context, key string, start, stop int) (res []string, err error) {
+func (r commands) ZRevRangeWithScore(ctx context.Context, key string, start, stop int) (res []string, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZREVRANGE", redisStrings, key, start, stop, "WITHSCORES")
 	if err != nil {
@@ -463,7 +534,7 @@ func (r *Redisgo) ZRevRangeWithScore(ctx context.Context, key string, start, sto
 	return
 }
 
-func (r *Redisgo) ZCount(ctx context.Context, key string, min, max int64) (res int, err error) {
+func (r commands) ZCount(ctx context.Context, key string, min, max int64) (res int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZCOUNT", redisInt, key, min, max)
 	if err != nil {
@@ -473,7 +544,7 @@ func (r *Redisgo) ZCount(ctx context.Context, key string, min, max int64) (res i
 	return
 }
 
-func (r *Redisgo) ZCard(ctx context.Context, key string) (res int, err error) {
+func (r commands) ZCard(ctx context.Context, key string) (res int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZCARD", redisInt, key)
 	if err != nil {
@@ -483,7 +554,7 @@ func (r *Redisgo) ZCard(ctx context.Context, key string) (res int, err error) {
 	return
 }
 
-func (r *Redisgo) LLen(ctx context.Context, key string) (res int64, err error) {
+func (r commands) LLen(ctx context.Context, key string) (res int64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "LLEN", redisInt64, key)
 	if err != nil {
@@ -493,7 +564,7 @@ func (r *Redisgo) LLen(ctx context.Context, key string) (res int64, err error) {
 	return
 }
 
-func (r *Redisgo) Incrby(ctx context.Context, key string, incr int) (res int64, err error) {
+func (r commands) Incrby(ctx context.Context, key string, incr int) (res int64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "INCRBY", redisInt64, key, incr)
 	if err != nil {
@@ -503,7 +574,7 @@ func (r *Redisgo) Incrby(ctx context.Context, key string, incr int) (res int64,
 	return
 }
 
-func (r *Redisgo) Incr(ctx context.Context, key string) (res int64, err error) {
+func (r commands) Incr(ctx context.Context, key string) (res int64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "INCR", redisInt64, key)
 	if err != nil {
@@ -513,7 +584,7 @@ func (r *Redisgo) Incr(ctx context.Context, key string) (res int64, err error) {
 	return
 }
 
-func (r *Redisgo) ZIncrby(ctx context.Context, key string, incr int, member string) (res int, err error) {
+func (r commands) ZIncrby(ctx context.Context, key string, incr int, member string) (res int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZINCRBY", redisInt, key, incr, member)
 	if err != nil {
@@ -526,7 +597,7 @@ func (r *Redisgo) ZIncrby(ctx context.Context, key string, incr int, member stri
 /*
 * If the member not in the zset or key not exits, ZRank will return ErrNil
  */
-func (r *Redisgo) ZRank(ctx context.Context, key string, member string) (res int, err error) {
+func (r commands) ZRank(ctx context.Context, key string, member string) (res int, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZRANK", redisInt, key, member)
 	if err != nil {
@@ -539,7 +610,7 @@ func (r *Redisgo) ZRank(ctx context.Context, key string, member string) (res int
 /*
 * 如果key 或者 member 不存在则会返回 ErrNil
  */
-func (r *Redisgo) ZRem(ctx context.Context, key string, members ...interface{}) (res int, err error) {
+func (r commands) ZRem(ctx context.Context, key string, members ...interface{}) (res int, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, members...)
@@ -552,7 +623,7 @@ func (r *Redisgo) ZRem(ctx context.Context, key string, members ...interface{})
 	return
 }
 
-func (r *Redisgo) ZRemrangebyrank(ctx context.Context, key string, members ...interface{}) (res int, err error) {
+func (r commands) ZRemrangebyrank(ctx context.Context, key string, members ...interface{}) (res int, err error) {
 	var reply interface{}
 	keys := []interface{}{key}
 	keys = append(keys, members...)
@@ -568,7 +639,7 @@ func (r *Redisgo) ZRemrangebyrank(ctx context.Context, key string, members ...in
 /*
 * 如果key 或者 member不存在则返回 ErrNil
  */
-func (r *Redisgo) ZScore(ctx context.Context, key, member string) (res float64, err error) {
+func (r commands) ZScore(ctx context.Context, key, member string) (res float64, err error) {
 	var reply interface{}
 	reply, err = r.do(ctx, "ZSCORE", redisFloat64, key, member)
 	if err != nil {
@@ -578,7 +649,7 @@ func (r *Redisgo) ZScore(ctx context.Context, key, member string) (res float64,
 	return
 }
 
-func (r *Redisgo) Zrevrange(ctx context.Context, key string, args ...interface{}) (res []string, err error) {
+func (r commands) Zrevrange(ctx context.Context, key string, args ...interface{}) (res []string, err error) {
 	var reply interface{}
 	argss := []interface{}{key}
 	argss = append(argss, args...)
@@ -590,7 +661,7 @@ func (r *Redisgo) Zrevrange(ctx context.Context, key string, args ...interface{}
 	return
 }
 
-func (r *Redisgo) Zrevrangebyscore(ctx context.Context, key string, args ...interface{}) (res []string, err error) {
+func (r commands) Zrevrangebyscore(ctx context.Context, key string, args ...interface{}) (res []string, err error) {
 	var reply interface{}
 	argss := []interface{}{key}
 	argss = append(argss, args...)
@@ -602,7 +673,7 @@ func (r *Redisgo) Zrevrangebyscore(ctx context.Context, key string, args ...inte
 	return
 }
 
-func (r *Redisgo) ZrevrangebyscoreInt(ctx context.Context, key string, args ...interface{}) (res []int, err error) {
+func (r commands) ZrevrangebyscoreInt(ctx context.Context, key string, args ...interface{}) (res []int, err error) {
 	var reply interface{}
 	argss := []interface{}{key}
 	argss = append(argss, args...)
@@ -0,0 +1,466 @@
+// Package delayqueue 基于有序集合的延迟任务队列
+// 任务按执行时间保存在有序集合中，worker 通过 Lua 脚本原子地认领到期的任务，
+// 处理失败按退避时间重试，超过最大次数后转入死信集合
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJobNotFound = errors.New("delayqueue: job not found")
+)
+
+// Job 队列中的任务
+type Job struct {
+	ID      string    `json:"id"`
+	Payload []byte    `json:"payload"`
+	RunAt   time.Time `json:"run_at"`
+	// Attempts 已经投递的次数，每次认领时加一，包括正在处理的这一次
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// LastError 最近一次失败的原因
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Handler 处理任务，返回 nil 时任务完成，否则按退避时间重试
+type Handler func(ctx context.Context, job *Job) error
+
+// Stats 队列状态
+type Stats struct {
+	// Depth 等待执行的任务数，包括未到期的任务
+	Depth int
+	// Ready 已经到期等待认领的任务数
+	Ready int
+	// Processing 已认领正在处理的任务数
+	Processing int
+	// Dead 死信集合中的任务数
+	Dead int
+	// Lag 最早到期但尚未被认领的任务已经等待的时间
+	Lag time.Duration
+}
+
+// 添加任务，保存任务数据和加入等待集合在同一个脚本中完成
+// KEYS: delayed, jobs  ARGV: id, data, score
+var enqueueScript = redisgo.NewScript(2, `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// 认领到期任务: 先将可见性超时的任务放回等待集合，再将到期任务移入处理集合并增加投递次数，
+// 因可见性超时被重复投递而超过最大次数的任务转入死信集合
+// KEYS: delayed, processing, jobs, dead  ARGV: now, limit, deadline, maxAttempts
+var claimScript = redisgo.NewScript(4, `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], ARGV[1], id)
+end
+
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local res = {}
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[3], id)
+	if data then
+		local job = cjson.decode(data)
+		job.attempts = (job.attempts or 0) + 1
+		local max = tonumber(ARGV[4])
+		if max > 0 and job.attempts > max then
+			job.last_error = 'visibility timeout exceeded'
+			redis.call('HSET', KEYS[3], id, cjson.encode(job))
+			redis.call('ZADD', KEYS[4], ARGV[1], id)
+		else
+			data = cjson.encode(job)
+			redis.call('HSET', KEYS[3], id, data)
+			redis.call('ZADD', KEYS[2], ARGV[3], id)
+			res[#res + 1] = data
+		end
+	end
+end
+return res
+`)
+
+// 任务处理完成后删除，只有仍在处理集合中(未因超时被重新投递)时才生效
+// KEYS: processing, jobs  ARGV: id
+var ackScript = redisgo.NewScript(2, `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`)
+
+// 将处理失败的任务移到 target 集合，用于重试和转入死信
+// KEYS: processing, jobs, target  ARGV: id, data, score
+var moveScript = redisgo.NewScript(3, `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+return 1
+`)
+
+type options struct {
+	concurrency  int
+	batch        int
+	pollInterval time.Duration
+	visibility   time.Duration
+	maxAttempts  int
+	backoff      func(attempts int) time.Duration
+}
+
+type Option func(*options)
+
+// WithConcurrency 同时处理任务的协程数
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithBatchSize 每次最多认领的任务数
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		o.batch = n
+	}
+}
+
+// WithPollInterval 没有到期任务时轮询的间隔
+func WithPollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = d
+	}
+}
+
+// WithVisibilityTimeout 认领后超过该时间仍未完成的任务会被重新投递，应大于任务的最长处理时间
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.visibility = d
+	}
+}
+
+// WithMaxAttempts 任务最多执行的次数，超过后转入死信集合
+func WithMaxAttempts(n int) Option {
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+// WithBackoff 第 attempts 次失败后等待多久重试
+func WithBackoff(fn func(attempts int) time.Duration) Option {
+	return func(o *options) {
+		o.backoff = fn
+	}
+}
+
+// defaultBackoff 从 1 秒开始指数增长，最长 1 小时，并增加最多 20% 的随机时间
+func defaultBackoff(attempts int) time.Duration {
+	d := time.Hour
+	if attempts < 12 {
+		d = time.Second << uint(attempts-1)
+		if d > time.Hour {
+			d = time.Hour
+		}
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// Queue 延迟队列，同名的队列共享数据，key 使用 {name} 作为 hash tag 以便在集群模式下使用
+type Queue struct {
+	r    *redisgo.Redisgo
+	name string
+	opts options
+
+	delayed    string
+	processing string
+	jobs       string
+	dead       string
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+func New(r *redisgo.Redisgo, name string, opts ...Option) *Queue {
+	o := options{
+		concurrency:  1,
+		batch:        10,
+		pollInterval: time.Second,
+		visibility:   5 * time.Minute,
+		maxAttempts:  5,
+		backoff:      defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency <= 0 {
+		o.concurrency = 1
+	}
+	if o.batch <= 0 {
+		o.batch = 1
+	}
+
+	prefix := "delayqueue:{" + name + "}:"
+	return &Queue{
+		r:          r,
+		name:       name,
+		opts:       o,
+		delayed:    prefix + "delayed",
+		processing: prefix + "processing",
+		jobs:       prefix + "jobs",
+		dead:       prefix + "dead",
+		sem:        make(chan struct{}, o.concurrency),
+	}
+}
+
+// Enqueue 添加在 runAt 执行的任务，返回任务 id
+func (q *Queue) Enqueue(ctx context.Context, payload []byte, runAt time.Time) (string, error) {
+	job := &Job{
+		ID:         uuid.New().String(),
+		Payload:    payload,
+		RunAt:      runAt,
+		EnqueuedAt: time.Now(),
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := enqueueScript.Int(ctx, q.r, q.delayed, q.jobs, job.ID, data, runAt.UnixMilli()); err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// EnqueueIn 添加 delay 之后执行的任务
+func (q *Queue) EnqueueIn(ctx context.Context, payload []byte, delay time.Duration) (string, error) {
+	return q.Enqueue(ctx, payload, time.Now().Add(delay))
+}
+
+// Cancel 取消尚未被认领的任务，任务不存在或已被认领时返回 ErrJobNotFound
+func (q *Queue) Cancel(ctx context.Context, id string) error {
+	n, err := q.r.ZRem(ctx, q.delayed, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	_, err = q.r.HDel(ctx, q.jobs, id)
+	return err
+}
+
+// Stats 返回队列深度和延迟
+func (q *Queue) Stats(ctx context.Context) (Stats, error) {
+	var s Stats
+	now := time.Now()
+
+	p := q.r.Pipeline(ctx)
+	depth := p.Do("ZCARD", q.delayed)
+	ready := p.Do("ZCOUNT", q.delayed, "-inf", now.UnixMilli())
+	processing := p.Do("ZCARD", q.processing)
+	dead := p.Do("ZCARD", q.dead)
+	oldest := p.Do("ZRANGE", q.delayed, 0, 0, "WITHSCORES")
+	if err := p.Exec(); err != nil {
+		return s, err
+	}
+
+	s.Depth = toInt(depth.Val())
+	s.Ready = toInt(ready.Val())
+	s.Processing = toInt(processing.Val())
+	s.Dead = toInt(dead.Val())
+	if values, ok := oldest.Val().([]interface{}); ok && len(values) == 2 {
+		if ms, err := redis.Int64(values[1], nil); err == nil {
+			if lag := now.Sub(time.UnixMilli(ms)); lag > 0 {
+				s.Lag = lag
+			}
+		}
+	}
+	return s, nil
+}
+
+// DeadJobs 返回死信集合中最早失败的 count 个任务
+func (q *Queue) DeadJobs(ctx context.Context, count int) ([]*Job, error) {
+	ids, err := q.r.ZRange(ctx, q.dead, 0, int64(count-1))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return q.loadJobs(ctx, ids)
+}
+
+// Requeue 将死信任务重新放回队列立即执行，并清零失败次数
+func (q *Queue) Requeue(ctx context.Context, id string) error {
+	jobs, err := q.loadJobs(ctx, []string{id})
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return ErrJobNotFound
+	}
+	job := jobs[0]
+	job.Attempts, job.LastError, job.RunAt = 0, "", time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	ok, err := moveScript.Int(ctx, q.r, q.dead, q.jobs, q.delayed, id, data, job.RunAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// PurgeDead 删除所有死信任务
+func (q *Queue) PurgeDead(ctx context.Context) error {
+	for {
+		ids, err := q.r.ZRange(ctx, q.dead, 0, 499)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		p := q.r.Pipeline(ctx)
+		for _, id := range ids {
+			p.ZRem(q.dead, id)
+			p.HDel(q.jobs, id)
+		}
+		if err := p.Exec(); err != nil {
+			return err
+		}
+	}
+}
+
+// Run 开始认领并处理到期任务，阻塞直到 ctx 结束，返回前等待处理中的任务完成
+func (q *Queue) Run(ctx context.Context, handler Handler) error {
+	defer q.wg.Wait()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// 只认领空闲 worker 能立即处理的数量，避免任务在本地排队时超过可见性超时
+		limit := q.opts.concurrency - len(q.sem)
+		if limit > q.opts.batch {
+			limit = q.opts.batch
+		}
+		var (
+			jobs []*Job
+			err  error
+		)
+		if limit > 0 {
+			jobs, err = q.claim(ctx, limit)
+		}
+		if err == nil && len(jobs) > 0 {
+			for _, job := range jobs {
+				q.dispatch(ctx, handler, job)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(q.opts.pollInterval):
+		}
+	}
+}
+
+func (q *Queue) claim(ctx context.Context, limit int) ([]*Job, error) {
+	now := time.Now()
+	values, err := claimScript.Strings(ctx, q.r, q.delayed, q.processing, q.jobs, q.dead,
+		now.UnixMilli(), limit, now.Add(q.opts.visibility).UnixMilli(), q.opts.maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(values))
+	for _, v := range values {
+		job := &Job{}
+		if err := json.Unmarshal([]byte(v), job); err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (q *Queue) dispatch(ctx context.Context, handler Handler, job *Job) {
+	q.sem <- struct{}{}
+	q.wg.Add(1)
+	go func() {
+		defer func() {
+			<-q.sem
+			q.wg.Done()
+		}()
+
+		err := handler(ctx, job)
+
+		// ctx 结束后仍需记录已处理完的任务
+		fctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err == nil {
+			ackScript.Int(fctx, q.r, q.processing, q.jobs, job.ID)
+			return
+		}
+		q.fail(fctx, job, err)
+	}()
+}
+
+// fail 按退避时间重新放回等待集合，次数用尽时转入死信集合，Attempts 已在认领时增加
+func (q *Queue) fail(ctx context.Context, job *Job, cause error) {
+	job.LastError = cause.Error()
+
+	target, score := q.dead, time.Now().UnixMilli()
+	if q.opts.maxAttempts <= 0 || job.Attempts < q.opts.maxAttempts {
+		job.RunAt = time.Now().Add(q.opts.backoff(job.Attempts))
+		target, score = q.delayed, job.RunAt.UnixMilli()
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	moveScript.Int(ctx, q.r, q.processing, q.jobs, target, job.ID, data, score)
+}
+
+func (q *Queue) loadJobs(ctx context.Context, ids []string) ([]*Job, error) {
+	p := q.r.Pipeline(ctx)
+	results := make([]*redisgo.PipeResult[string], 0, len(ids))
+	for _, id := range ids {
+		results = append(results, p.HGet(q.jobs, id))
+	}
+	if err := p.Exec(); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(ids))
+	for _, res := range results {
+		data := res.Val()
+		if data == "" {
+			continue
+		}
+		job := &Job{}
+		if err := json.Unmarshal([]byte(data), job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func toInt(v interface{}) int {
+	n, _ := v.(int64)
+	return int(n)
+}
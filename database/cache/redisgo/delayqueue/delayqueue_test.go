@@ -0,0 +1,205 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestDefaultBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 5: 16 * time.Second, 20: time.Hour} {
+		if got := defaultBackoff(attempts); got < want || got > want+want/5 {
+			t.Errorf("attempts %d: got %v, want [%v, %v]", attempts, got, want, want+want/5)
+		}
+	}
+}
+
+// TestQueue 设置 REDISGO_TEST_ADDR 时对真实的 redis 执行
+func TestQueue(t *testing.T) {
+	addr := os.Getenv("REDISGO_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDISGO_TEST_ADDR not set")
+	}
+	r := redisgo.NewRedisgo(redisgo.WithAddr(addr))
+	defer r.Close()
+	ctx := context.Background()
+
+	newQueue := func(t *testing.T, opts ...Option) *Queue {
+		name := t.Name() + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		q := New(r, name, append([]Option{WithPollInterval(10 * time.Millisecond)}, opts...)...)
+		t.Cleanup(func() {
+			r.DoCtx(ctx, "DEL", q.delayed, q.processing, q.jobs, q.dead)
+		})
+		return q
+	}
+	// run 在后台处理任务直到测试结束
+	run := func(t *testing.T, q *Queue, handler Handler) {
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			q.Run(rctx, handler)
+			close(done)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+	waitDead := func(t *testing.T, q *Queue) *Job {
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			jobs, err := q.DeadJobs(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) > 0 {
+				return jobs[0]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("timeout waiting for dead job")
+		return nil
+	}
+
+	t.Run("EnqueueCancel", func(t *testing.T) {
+		q := newQueue(t)
+		if _, err := q.Enqueue(ctx, []byte("now"), time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		id, err := q.EnqueueIn(ctx, []byte("later"), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := q.Stats(ctx)
+		if err != nil || s.Depth != 2 || s.Ready != 1 || s.Lag < time.Second {
+			t.Fatalf("stats: got %+v, %v", s, err)
+		}
+		if err := q.Cancel(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Cancel(ctx, id); err != ErrJobNotFound {
+			t.Fatalf("cancel twice: got %v", err)
+		}
+		if n, _ := redis.Int(r.DoCtx(ctx, "HLEN", q.jobs)); n != 1 {
+			t.Fatalf("jobs after cancel: got %d, want 1", n)
+		}
+	})
+
+	t.Run("RetryDeadLetter", func(t *testing.T) {
+		q := newQueue(t, WithMaxAttempts(3), WithBackoff(func(attempts int) time.Duration {
+			return time.Duration(attempts) * 20 * time.Millisecond
+		}))
+		var (
+			mu       sync.Mutex
+			attempts []int
+			times    []time.Time
+		)
+		id, err := q.Enqueue(ctx, []byte("x"), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		run(t, q, func(ctx context.Context, job *Job) error {
+			mu.Lock()
+			attempts = append(attempts, job.Attempts)
+			times = append(times, time.Now())
+			mu.Unlock()
+			return errors.New("boom " + strconv.Itoa(job.Attempts))
+		})
+
+		job := waitDead(t, q)
+		if job.ID != id || job.Attempts != 3 || job.LastError != "boom 3" || string(job.Payload) != "x" {
+			t.Fatalf("dead job: got %+v", job)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(attempts) != 3 || attempts[0] != 1 || attempts[1] != 2 || attempts[2] != 3 {
+			t.Fatalf("attempts: got %v", attempts)
+		}
+		// 第 n 次失败后等待 n*20ms
+		for i := 1; i < len(times); i++ {
+			if d := times[i].Sub(times[i-1]); d < time.Duration(i)*20*time.Millisecond {
+				t.Errorf("retry %d after %v", i, d)
+			}
+		}
+	})
+
+	t.Run("VisibilityTimeout", func(t *testing.T) {
+		q := newQueue(t, WithConcurrency(3), WithMaxAttempts(2), WithVisibilityTimeout(50*time.Millisecond))
+		var (
+			mu       sync.Mutex
+			attempts []int
+		)
+		if _, err := q.Enqueue(ctx, []byte("slow"), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		// 处理一直不结束，超过可见性超时后被重新投递
+		run(t, q, func(ctx context.Context, job *Job) error {
+			mu.Lock()
+			attempts = append(attempts, job.Attempts)
+			mu.Unlock()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		job := waitDead(t, q)
+		if job.Attempts != 3 || job.LastError != "visibility timeout exceeded" {
+			t.Fatalf("dead job: got %+v", job)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+			t.Fatalf("attempts: got %v", attempts)
+		}
+	})
+
+	t.Run("Requeue", func(t *testing.T) {
+		q := newQueue(t, WithMaxAttempts(1))
+		id, err := q.Enqueue(ctx, []byte("x"), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan int, 2)
+		fail := true
+		run(t, q, func(ctx context.Context, job *Job) error {
+			done <- job.Attempts
+			if fail {
+				fail = false
+				return errors.New("boom")
+			}
+			return nil
+		})
+		waitDead(t, q)
+		if err := q.Requeue(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+		// 重新放回队列时清零失败次数
+		if got := <-done; got != 1 {
+			t.Fatalf("attempts after requeue: got %d, want 1", got)
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			s, err := q.Stats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == (Stats{}) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("stats after ack: got %+v", s)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := q.Requeue(ctx, id); err != ErrJobNotFound {
+			t.Fatalf("requeue acked job: got %v", err)
+		}
+	})
+}
@@ -2,10 +2,28 @@ package redisgo
 
 import (
 	"errors"
+	"github.com/gomodule/redigo/redis"
+	"strings"
 )
 
 var (
 	ErrConnExhausted = errors.New("redis: connection exhausted, please retry")
 	ErrTimeout       = errors.New("redis: i/o timeout, please retry")
 	ErrKeyNoExist    = errors.New("key does not exist")
+	ErrCircuitOpen   = errors.New("redis: circuit breaker is open")
+	// ErrUnknownCommandKeys 设置了 KeyPrefix 时执行了不知道 key 位置的命令，见 RegisterCommandKeys
+	ErrUnknownCommandKeys = errors.New("redis: unknown key positions of command")
 )
+
+// convertErr 将底层连接错误转换为包内定义的错误
+func convertErr(err error) error {
+	switch err {
+	case redis.ErrPoolExhausted:
+		return ErrConnExhausted
+	default:
+		if strings.Contains(err.Error(), "timeout") {
+			return ErrTimeout
+		}
+		return err
+	}
+}
@@ -0,0 +1,177 @@
+package redisgo
+
+import (
+	"context"
+	"github.com/aloeproject/toolbox/logger"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+	"time"
+)
+
+// HookCmd 传给 Hook 的命令
+// BeforeProcess 中可以修改 Name 和 Args，例如增加 key 前缀
+// AfterProcess 中可以读取或替换 Reply 和 Err，替换 Reply 时需要保持类型不变
+type HookCmd struct {
+	Name     string
+	Args     []interface{}
+	Reply    interface{}
+	Err      error
+	Duration time.Duration
+}
+
+// Hook 命令执行前后的扩展点，多个 Hook 按 WithHooks 的顺序调用 Before，按相反的顺序调用 After
+// Before 返回错误时命令不会执行，错误作为命令的结果，已经调用过 Before 的 Hook 仍会调用 After
+// After 返回错误时替换命令的错误
+type Hook interface {
+	BeforeProcess(ctx context.Context, cmd *HookCmd) (context.Context, error)
+	AfterProcess(ctx context.Context, cmd *HookCmd) error
+	BeforeProcessPipeline(ctx context.Context, cmds []*HookCmd) (context.Context, error)
+	AfterProcessPipeline(ctx context.Context, cmds []*HookCmd) error
+}
+
+// processHooks 按顺序调用 hook，fn 执行命令
+func (r *Redisgo) processHooks(ctx context.Context, name string, args []interface{}, fn func(ctx context.Context, name string, args []interface{}) (interface{}, error)) (interface{}, error) {
+	hooks := r.opts.Hooks
+	if len(hooks) == 0 {
+		return fn(ctx, name, args)
+	}
+
+	cmd := &HookCmd{Name: name, Args: args}
+	i := 0
+	for i < len(hooks) {
+		c, err := hooks[i].BeforeProcess(ctx, cmd)
+		i++
+		if err != nil {
+			cmd.Err = err
+			break
+		}
+		ctx = c
+	}
+	if cmd.Err == nil {
+		start := time.Now()
+		cmd.Reply, cmd.Err = fn(ctx, cmd.Name, cmd.Args)
+		cmd.Duration = time.Since(start)
+	}
+	for i--; i >= 0; i-- {
+		if err := hooks[i].AfterProcess(ctx, cmd); err != nil {
+			cmd.Err = err
+		}
+	}
+	return cmd.Reply, cmd.Err
+}
+
+// processPipelineHooks 与 processHooks 相同，用于 pipeline 和事务，Duration 为整批命令的耗时
+func (r *Redisgo) processPipelineHooks(ctx context.Context, cmds []*pipeCmd, fn func(ctx context.Context) error) error {
+	hooks := r.opts.Hooks
+	if len(hooks) == 0 {
+		return fn(ctx)
+	}
+
+	hcs := make([]*HookCmd, len(cmds))
+	for i, c := range cmds {
+		hcs[i] = &HookCmd{Name: c.name, Args: c.args}
+	}
+
+	var err error
+	i := 0
+	for i < len(hooks) {
+		c, herr := hooks[i].BeforeProcessPipeline(ctx, hcs)
+		i++
+		if herr != nil {
+			err = herr
+			break
+		}
+		ctx = c
+	}
+
+	if err == nil {
+		for j, c := range cmds {
+			c.name, c.args = hcs[j].Name, hcs[j].Args
+		}
+		start := time.Now()
+		err = fn(ctx)
+		d := time.Since(start)
+		for j, c := range cmds {
+			hcs[j].Reply, hcs[j].Err, hcs[j].Duration = c.reply, c.err, d
+		}
+	} else {
+		for _, hc := range hcs {
+			hc.Err = err
+		}
+	}
+
+	for i--; i >= 0; i-- {
+		if herr := hooks[i].AfterProcessPipeline(ctx, hcs); herr != nil {
+			err = herr
+		}
+	}
+	for j, c := range cmds {
+		c.reply, c.err = hcs[j].Reply, hcs[j].Err
+	}
+	return err
+}
+
+// LogHook 记录执行时间超过阈值的命令和执行失败的命令，日志中只包含 key，不包含值
+type LogHook struct {
+	log  logger.ILogger
+	slow time.Duration
+}
+
+var _ Hook = (*LogHook)(nil)
+
+// NewLogHook slow 为慢命令的阈值，为 0 时只记录失败的命令
+func NewLogHook(log logger.ILogger, slow time.Duration) *LogHook {
+	return &LogHook{log: log, slow: slow}
+}
+
+func (h *LogHook) BeforeProcess(ctx context.Context, cmd *HookCmd) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *LogHook) AfterProcess(ctx context.Context, cmd *HookCmd) error {
+	h.report(ctx, "", cmd.Duration, cmd.Err, cmd)
+	return nil
+}
+
+func (h *LogHook) BeforeProcessPipeline(ctx context.Context, cmds []*HookCmd) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *LogHook) AfterProcessPipeline(ctx context.Context, cmds []*HookCmd) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	var err error
+	for _, c := range cmds {
+		if c.Err != nil && !isServerError(c.Err) {
+			err = c.Err
+			break
+		}
+	}
+	h.report(ctx, "pipeline ", cmds[0].Duration, err, cmds...)
+	return nil
+}
+
+func (h *LogHook) report(ctx context.Context, kind string, d time.Duration, err error, cmds ...*HookCmd) {
+	// 服务端返回的错误(如 WRONGTYPE)属于调用方的问题，不记录
+	if err != nil && !isServerError(err) {
+		h.log.Errorw(ctx, "redis %scommand failed: %s, duration: %v, error: %v", kind, statement(cmds), d, err)
+		return
+	}
+	if h.slow > 0 && d >= h.slow {
+		h.log.Warnw(ctx, "redis slow %scommand: %s, duration: %v", kind, statement(cmds), d)
+	}
+}
+
+func isServerError(err error) bool {
+	_, ok := err.(redis.Error)
+	return ok
+}
+
+func statement(cmds []*HookCmd) string {
+	lines := make([]string, 0, len(cmds))
+	for _, c := range cmds {
+		lines = append(lines, sanitizeCommand(strings.ToUpper(c.Name), c.Args))
+	}
+	return strings.Join(lines, "; ")
+}
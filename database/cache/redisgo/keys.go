@@ -0,0 +1,401 @@
+package redisgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keySpec 命令参数中 key 的位置，含义与 COMMAND INFO 的 first/last/step 相同
+// last 为负数时表示从末尾倒数，first 为 -1 表示命令不包含 key
+type keySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+var (
+	singleKey = keySpec{0, 0, 1}
+	noKey     = keySpec{-1, 0, 0}
+	allKeys   = keySpec{0, -1, 1}
+	twoKeys   = keySpec{0, 1, 1}
+)
+
+var commandKeys = map[string]keySpec{
+	"MGET":           allKeys,
+	"DEL":            allKeys,
+	"UNLINK":         allKeys,
+	"EXISTS":         allKeys,
+	"TOUCH":          allKeys,
+	"WATCH":          allKeys,
+	"SINTER":         allKeys,
+	"SUNION":         allKeys,
+	"SDIFF":          allKeys,
+	"SINTERSTORE":    allKeys,
+	"SUNIONSTORE":    allKeys,
+	"SDIFFSTORE":     allKeys,
+	"PFCOUNT":        allKeys,
+	"PFMERGE":        allKeys,
+	"MSET":           {0, -1, 2},
+	"MSETNX":         {0, -1, 2},
+	"RENAME":         twoKeys,
+	"RENAMENX":       twoKeys,
+	"RPOPLPUSH":      twoKeys,
+	"BRPOPLPUSH":     twoKeys,
+	"LMOVE":          twoKeys,
+	"BLMOVE":         twoKeys,
+	"SMOVE":          twoKeys,
+	"COPY":           twoKeys,
+	"LCS":            twoKeys,
+	"ZRANGESTORE":    twoKeys,
+	"GEOSEARCHSTORE": twoKeys,
+	"BITOP":          {1, -1, 1},
+	"BLPOP":          {0, -2, 1},
+	"BRPOP":          {0, -2, 1},
+	"BZPOPMIN":       {0, -2, 1},
+	"BZPOPMAX":       {0, -2, 1},
+	"XGROUP":         {1, 1, 1},
+	"XINFO":          {1, 1, 1},
+	"OBJECT":         {1, 1, 1},
+	"MEMORY":         {1, 1, 1},
+
+	"PING":         noKey,
+	"ECHO":         noKey,
+	"INFO":         noKey,
+	"TIME":         noKey,
+	"ROLE":         noKey,
+	"DBSIZE":       noKey,
+	"FLUSHDB":      noKey,
+	"FLUSHALL":     noKey,
+	"SCRIPT":       noKey,
+	"CLUSTER":      noKey,
+	"CLIENT":       noKey,
+	"CONFIG":       noKey,
+	"COMMAND":      noKey,
+	"KEYS":         noKey,
+	"SCAN":         noKey,
+	"RANDOMKEY":    noKey,
+	"PUBLISH":      noKey,
+	"PUBSUB":       noKey,
+	"SUBSCRIBE":    noKey,
+	"PSUBSCRIBE":   noKey,
+	"UNSUBSCRIBE":  noKey,
+	"PUNSUBSCRIBE": noKey,
+	"MULTI":        noKey,
+	"EXEC":         noKey,
+	"DISCARD":      noKey,
+	"UNWATCH":      noKey,
+	"ASKING":       noKey,
+	"READONLY":     noKey,
+	"READWRITE":    noKey,
+	"SELECT":       noKey,
+	"SWAPDB":       noKey,
+	"AUTH":         noKey,
+	"HELLO":        noKey,
+	"RESET":        noKey,
+	"QUIT":         noKey,
+	"WAIT":         noKey,
+	"WAITAOF":      noKey,
+	"SLOWLOG":      noKey,
+	"LATENCY":      noKey,
+	"FUNCTION":     noKey,
+	"LASTSAVE":     noKey,
+	"SAVE":         noKey,
+	"BGSAVE":       noKey,
+	"BGREWRITEAOF": noKey,
+	"ACL":          noKey,
+	"MODULE":       noKey,
+	"MONITOR":      noKey,
+	"REPLICAOF":    noKey,
+	"SLAVEOF":      noKey,
+}
+
+// singleKeyCommands 只有第一个参数为 key 的命令
+var singleKeyCommands = []string{
+	// key
+	"TYPE", "TTL", "PTTL", "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "EXPIRETIME", "PEXPIRETIME",
+	"PERSIST", "DUMP", "RESTORE", "RESTORE-ASKING", "MOVE",
+	// string
+	"GET", "SET", "SETNX", "SETEX", "PSETEX", "GETSET", "GETDEL", "GETEX", "GETRANGE", "SETRANGE",
+	"SUBSTR", "APPEND", "STRLEN", "INCR", "INCRBY", "INCRBYFLOAT", "DECR", "DECRBY",
+	"SETBIT", "GETBIT", "BITCOUNT", "BITPOS", "BITFIELD", "BITFIELD_RO", "PFADD",
+	// hash
+	"HSET", "HSETNX", "HGET", "HMSET", "HMGET", "HDEL", "HEXISTS", "HLEN", "HKEYS", "HVALS",
+	"HGETALL", "HINCRBY", "HINCRBYFLOAT", "HSTRLEN", "HSCAN", "HRANDFIELD",
+	// list
+	"LPUSH", "RPUSH", "LPUSHX", "RPUSHX", "LPOP", "RPOP", "LLEN", "LRANGE", "LINDEX", "LSET",
+	"LREM", "LTRIM", "LINSERT", "LPOS",
+	// set
+	"SADD", "SREM", "SISMEMBER", "SMISMEMBER", "SCARD", "SMEMBERS", "SPOP", "SRANDMEMBER", "SSCAN",
+	// sorted set
+	"ZADD", "ZINCRBY", "ZREM", "ZCARD", "ZCOUNT", "ZSCORE", "ZMSCORE", "ZRANK", "ZREVRANK",
+	"ZRANGE", "ZREVRANGE", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZRANGEBYLEX", "ZREVRANGEBYLEX",
+	"ZLEXCOUNT", "ZREMRANGEBYRANK", "ZREMRANGEBYSCORE", "ZREMRANGEBYLEX", "ZPOPMIN", "ZPOPMAX",
+	"ZRANDMEMBER", "ZSCAN",
+	// geo
+	"GEOADD", "GEODIST", "GEOHASH", "GEOPOS", "GEOSEARCH", "GEORADIUS_RO", "GEORADIUSBYMEMBER_RO",
+	// stream
+	"XADD", "XLEN", "XRANGE", "XREVRANGE", "XDEL", "XTRIM", "XACK", "XPENDING", "XCLAIM",
+	"XAUTOCLAIM", "XSETID",
+}
+
+func init() {
+	for _, cmd := range singleKeyCommands {
+		commandKeys[cmd] = singleKey
+	}
+}
+
+// numKeysSpec key 的个数由 numkeys 参数给出的命令，index 为 numkeys 的下标，key 紧跟在 numkeys 之后
+// dest 为 true 时第一个参数也是 key，如 ZUNIONSTORE destination numkeys key [key ...]
+type numKeysSpec struct {
+	index int
+	dest  bool
+}
+
+var numKeysCommands = map[string]numKeysSpec{
+	"EVAL":        {1, false},
+	"EVALSHA":     {1, false},
+	"EVAL_RO":     {1, false},
+	"EVALSHA_RO":  {1, false},
+	"FCALL":       {1, false},
+	"FCALL_RO":    {1, false},
+	"ZUNION":      {0, false},
+	"ZINTER":      {0, false},
+	"ZDIFF":       {0, false},
+	"ZINTERCARD":  {0, false},
+	"SINTERCARD":  {0, false},
+	"LMPOP":       {0, false},
+	"ZMPOP":       {0, false},
+	"BLMPOP":      {1, false},
+	"BZMPOP":      {1, false},
+	"ZUNIONSTORE": {1, true},
+	"ZINTERSTORE": {1, true},
+	"ZDIFFSTORE":  {1, true},
+}
+
+// RegisterCommandKeys 登记命令中 key 的位置，含义与 COMMAND INFO 的 first/last/step 相同，下标从 0 开始
+// 用于模块命令等没有内置的命令，设置了 KeyPrefix 时未登记的命令会返回 ErrUnknownCommandKeys
+// 应当在包初始化时调用
+func RegisterCommandKeys(cmd string, first, last, step int) {
+	commandKeys[strings.ToUpper(cmd)] = keySpec{first, last, step}
+}
+
+// commandKeyIndexes 返回命令参数中所有 key 的下标
+// 不知道 key 位置的命令按第一个参数为 key 处理，ok 为 false
+func commandKeyIndexes(cmd string, args []interface{}) (idx []int, ok bool) {
+	cmd = strings.ToUpper(cmd)
+	if spec, ok := numKeysCommands[cmd]; ok {
+		if spec.dest && len(args) > 0 {
+			idx = append(idx, 0)
+		}
+		if spec.index >= len(args) {
+			return idx, true
+		}
+		n, err := strconv.Atoi(keyString(args[spec.index]))
+		if err != nil {
+			return idx, true
+		}
+		for i := spec.index + 1; i <= spec.index+n && i < len(args); i++ {
+			idx = append(idx, i)
+		}
+		return idx, true
+	}
+
+	switch cmd {
+	case "XREAD", "XREADGROUP":
+		// ... STREAMS key [key ...] id [id ...]
+		for i, a := range args {
+			if strings.EqualFold(keyString(a), "STREAMS") {
+				n := (len(args) - i - 1) / 2
+				idx := make([]int, 0, n)
+				for j := i + 1; j <= i+n; j++ {
+					idx = append(idx, j)
+				}
+				return idx, true
+			}
+		}
+		return nil, true
+	case "SORT", "SORT_RO", "GEORADIUS", "GEORADIUSBYMEMBER":
+		// key ... [STORE destination]，GEORADIUS 还有 STOREDIST destination
+		if len(args) == 0 {
+			return nil, true
+		}
+		idx = []int{0}
+		for i := 1; i+1 < len(args); i++ {
+			if s := keyString(args[i]); strings.EqualFold(s, "STORE") || strings.EqualFold(s, "STOREDIST") {
+				idx = append(idx, i+1)
+				i++
+			}
+		}
+		return idx, true
+	}
+
+	spec, ok := commandKeys[cmd]
+	if !ok {
+		spec = singleKey
+	}
+	if spec.first < 0 || spec.first >= len(args) {
+		return nil, ok
+	}
+	last := spec.last
+	if last < 0 {
+		last = len(args) + last
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+	if last < spec.first {
+		return nil, ok
+	}
+	idx = make([]int, 0, (last-spec.first)/spec.step+1)
+	for i := spec.first; i <= last; i += spec.step {
+		idx = append(idx, i)
+	}
+	return idx, ok
+}
+
+func keyString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// prefixCommand 为命令中的 key 加上 r.prefix，KEYS 和 SCAN 的 pattern 只匹配带前缀的 key
+// 返回值中包含 key 的命令(KEYS、SCAN、BLPOP、XREAD 等)通过包装 f 去掉前缀，args 不会被修改
+// 不知道 key 位置的命令返回 ErrUnknownCommandKeys，避免读写前缀之外的 key
+func (r *Redisgo) prefixCommand(cmd string, args []interface{}, f func(interface{}, error) (interface{}, error)) ([]interface{}, func(interface{}, error) (interface{}, error), error) {
+	if r.prefix == "" {
+		return args, f, nil
+	}
+	prefixed := make([]interface{}, len(args), len(args)+2)
+	copy(prefixed, args)
+
+	var strip func(reply interface{}) interface{}
+	switch cmd = strings.ToUpper(cmd); cmd {
+	case "KEYS":
+		if len(prefixed) > 0 {
+			prefixed[0] = escapeGlob(r.prefix) + keyString(prefixed[0])
+		}
+		strip = r.stripKeys
+	case "SCAN":
+		prefixed = r.prefixScanMatch(prefixed)
+		strip = func(reply interface{}) interface{} {
+			if values, ok := reply.([]interface{}); ok && len(values) == 2 {
+				values[1] = r.stripKeys(values[1])
+			}
+			return reply
+		}
+	default:
+		idx, ok := commandKeyIndexes(cmd, prefixed)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownCommandKeys, cmd)
+		}
+		for _, i := range idx {
+			prefixed[i] = r.prefix + keyString(prefixed[i])
+		}
+		switch cmd {
+		case "SORT", "SORT_RO":
+			r.prefixSortPatterns(prefixed)
+		case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX", "LMPOP", "BLMPOP", "ZMPOP", "BZMPOP", "RANDOMKEY":
+			// 返回值的第一项为 key
+			strip = func(reply interface{}) interface{} {
+				if values, ok := reply.([]interface{}); ok && len(values) > 0 {
+					values[0] = r.stripKey(values[0])
+					return values
+				}
+				return r.stripKey(reply)
+			}
+		case "XREAD", "XREADGROUP":
+			// [[key, entries], ...]
+			strip = func(reply interface{}) interface{} {
+				if streams, ok := reply.([]interface{}); ok {
+					for _, s := range streams {
+						if kv, ok := s.([]interface{}); ok && len(kv) > 0 {
+							kv[0] = r.stripKey(kv[0])
+						}
+					}
+				}
+				return reply
+			}
+		}
+	}
+
+	if strip == nil {
+		return prefixed, f, nil
+	}
+	return prefixed, func(reply interface{}, err error) (interface{}, error) {
+		if err == nil {
+			reply = strip(reply)
+		}
+		if f != nil {
+			return f(reply, err)
+		}
+		return reply, err
+	}, nil
+}
+
+// prefixSortPatterns SORT 的 BY 和 GET 引用其他 key，nosort 和 # 不是 key
+func (r *Redisgo) prefixSortPatterns(args []interface{}) {
+	for i := 1; i+1 < len(args); i++ {
+		s := keyString(args[i])
+		if !strings.EqualFold(s, "BY") && !strings.EqualFold(s, "GET") {
+			continue
+		}
+		i++
+		if p := keyString(args[i]); p != "#" && !strings.EqualFold(p, "nosort") {
+			args[i] = r.prefix + p
+		}
+	}
+}
+
+// prefixScanMatch SCAN 没有 MATCH 时增加 MATCH prefix*，只遍历当前前缀下的 key
+func (r *Redisgo) prefixScanMatch(args []interface{}) []interface{} {
+	for i := 1; i+1 < len(args); i++ {
+		if strings.EqualFold(keyString(args[i]), "MATCH") {
+			args[i+1] = escapeGlob(r.prefix) + keyString(args[i+1])
+			return args
+		}
+	}
+	return append(args, "MATCH", escapeGlob(r.prefix)+"*")
+}
+
+func (r *Redisgo) stripKey(key interface{}) interface{} {
+	switch v := key.(type) {
+	case []byte:
+		return []byte(strings.TrimPrefix(string(v), r.prefix))
+	case string:
+		return strings.TrimPrefix(v, r.prefix)
+	default:
+		return key
+	}
+}
+
+func (r *Redisgo) stripKeys(reply interface{}) interface{} {
+	if keys, ok := reply.([]interface{}); ok {
+		for i, k := range keys {
+			keys[i] = r.stripKey(k)
+		}
+	}
+	return reply
+}
+
+// escapeGlob 转义前缀中的通配符，使 pattern 只匹配字面上的前缀
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
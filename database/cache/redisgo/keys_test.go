@@ -0,0 +1,62 @@
+package redisgo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPrefixCommand(t *testing.T) {
+	r := &Redisgo{prefix: "p:"}
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		want []interface{}
+	}{
+		{"GET", []interface{}{"a"}, []interface{}{"p:a"}},
+		{"MSET", []interface{}{"a", 1, "b", 2}, []interface{}{"p:a", 1, "p:b", 2}},
+		{"ZUNIONSTORE", []interface{}{"d", 2, "a", "b", "WEIGHTS", 1, 2}, []interface{}{"p:d", 2, "p:a", "p:b", "WEIGHTS", 1, 2}},
+		{"ZINTER", []interface{}{2, "a", "b", "WITHSCORES"}, []interface{}{2, "p:a", "p:b", "WITHSCORES"}},
+		{"SINTERCARD", []interface{}{2, "a", "b", "LIMIT", 1}, []interface{}{2, "p:a", "p:b", "LIMIT", 1}},
+		{"BLMPOP", []interface{}{0, 2, "a", "b", "LEFT"}, []interface{}{0, 2, "p:a", "p:b", "LEFT"}},
+		{"EVALSHA", []interface{}{"sha", 1, "a", "arg"}, []interface{}{"sha", 1, "p:a", "arg"}},
+		{"COPY", []interface{}{"a", "b", "REPLACE"}, []interface{}{"p:a", "p:b", "REPLACE"}},
+		{"BITOP", []interface{}{"AND", "d", "a", "b"}, []interface{}{"AND", "p:d", "p:a", "p:b"}},
+		{"SMISMEMBER", []interface{}{"a", "m1", "m2"}, []interface{}{"p:a", "m1", "m2"}},
+		{"SORT", []interface{}{"a", "BY", "w_*", "GET", "#", "GET", "o_*", "STORE", "d"}, []interface{}{"p:a", "BY", "p:w_*", "GET", "#", "GET", "p:o_*", "STORE", "p:d"}},
+		{"XREAD", []interface{}{"COUNT", 1, "STREAMS", "a", "b", "0", "0"}, []interface{}{"COUNT", 1, "STREAMS", "p:a", "p:b", "0", "0"}},
+		{"PING", nil, []interface{}{}},
+	}
+	for _, tt := range tests {
+		got, _, err := r.prefixCommand(tt.cmd, tt.args, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.cmd, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.cmd, got, tt.want)
+		}
+	}
+
+	if _, _, err := r.prefixCommand("JSON.SET", []interface{}{"a", "$", "1"}, nil); !errors.Is(err, ErrUnknownCommandKeys) {
+		t.Errorf("unknown command: got %v, want ErrUnknownCommandKeys", err)
+	}
+}
+
+// TestLockKeysSlot 加锁脚本的两个 key 加上前缀之后仍然在同一个 slot
+func TestLockKeysSlot(t *testing.T) {
+	for _, prefix := range []string{"", "p:", "{app}:"} {
+		r := &Redisgo{prefix: prefix}
+		for _, key := range []string{"k", "order:1", "a{x}b", "{}k"} {
+			lock, fence := lockKeys(key)
+			args := lockAcquireScript.args(lockAcquireScript.Hash(), []interface{}{lock, fence, "token", 1000})
+			prefixed, _, err := r.prefixCommand("EVALSHA", args, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := commandSlot("EVALSHA", prefixed); err != nil {
+				t.Errorf("prefix %q key %q: %v, keys %v %v", prefix, key, err, prefixed[2], prefixed[3])
+			}
+		}
+	}
+}
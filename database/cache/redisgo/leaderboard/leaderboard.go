@@ -0,0 +1,357 @@
+// Package leaderboard 基于有序集合的排行榜
+// 成员、分数和排名以 Entry 返回，支持三种排名方式、按达到分数的时间打破平局，
+// 以及同时写入按天、按周自动过期的周期榜
+package leaderboard
+
+import (
+	"context"
+	"errors"
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrMemberNotFound  = errors.New("leaderboard: member not found")
+	ErrNonInteger      = errors.New("leaderboard: score must be an integer when tie-break is enabled")
+	ErrScoreOutOfRange = errors.New("leaderboard: score out of range")
+	ErrInvalidPage     = errors.New("leaderboard: invalid page")
+)
+
+// Ranking 分数相同时的排名方式
+type Ranking int
+
+const (
+	// OrdinalRanking 每个成员的排名都不同，如 1,2,3,4，分数相同时的先后由 WithTieBreak 决定
+	OrdinalRanking Ranking = iota
+	// StandardRanking 分数相同排名相同，之后的排名跳过，如 1,2,2,4
+	StandardRanking
+	// DenseRanking 分数相同排名相同，之后的排名连续，如 1,2,2,3
+	// 需要额外维护去重后的分数集合，写入开销更大
+	DenseRanking
+)
+
+// Window 榜单的时间窗口
+type Window int
+
+const (
+	// AllTime 总榜，不会过期
+	AllTime Window = iota
+	// Daily 日榜，从每天零点开始
+	Daily
+	// Weekly 周榜，从每周一零点开始
+	Weekly
+)
+
+func (w Window) String() string {
+	switch w {
+	case AllTime:
+		return "all"
+	case Daily:
+		return "daily"
+	case Weekly:
+		return "weekly"
+	default:
+		return "window(" + strconv.Itoa(int(w)) + ")"
+	}
+}
+
+// Entry 榜单中的一个成员，Rank 从 1 开始
+type Entry struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+	Rank   int64   `json:"rank"`
+}
+
+var (
+	// epoch 总榜打破平局时计时的起点
+	epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	// horizon 总榜打破平局时能区分的时间范围
+	horizon = 100 * 365 * 24 * time.Hour
+)
+
+type options struct {
+	prefix    string
+	ranking   Ranking
+	tieBreak  time.Duration
+	windows   []Window
+	retention time.Duration
+	loc       *time.Location
+	now       func() time.Time
+}
+
+type Option func(*options)
+
+// WithPrefix 榜单 key 的前缀，默认为 "leaderboard:"
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithRanking 排名方式，默认为 OrdinalRanking
+func WithRanking(ranking Ranking) Option {
+	return func(o *options) {
+		o.ranking = ranking
+	}
+}
+
+// WithTieBreak 分数相同时先达到该分数的成员排在前面，时间以 resolution 为精度编码在分数的低位
+// 开启后分数必须为整数，绝对值的上限见 View.MaxScore，精度越粗上限越大
+// 已有数据的榜单不能再开启、关闭或修改精度
+func WithTieBreak(resolution time.Duration) Option {
+	return func(o *options) {
+		o.tieBreak = resolution
+	}
+}
+
+// WithWindows 每次写入同时更新的时间窗口，默认只有 AllTime
+func WithWindows(windows ...Window) Option {
+	return func(o *options) {
+		o.windows = windows
+	}
+}
+
+// WithRetention 周期榜在窗口结束后保留的时间，默认 7 天
+func WithRetention(d time.Duration) Option {
+	return func(o *options) {
+		o.retention = d
+	}
+}
+
+// WithLocation 划分日榜、周榜使用的时区，默认为 time.Local
+func WithLocation(loc *time.Location) Option {
+	return func(o *options) {
+		o.loc = loc
+	}
+}
+
+// WithClock 写入时使用的时钟，决定写入的周期榜和打破平局的时间
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// Leaderboard 排行榜，写入时更新所有配置的时间窗口，通过 View 查询某个窗口
+type Leaderboard struct {
+	r    *redisgo.Redisgo
+	name string
+	opts options
+}
+
+// New 创建名为 name 的排行榜，所有窗口的 key 使用相同的 hash tag，集群模式下位于同一个槽
+func New(r *redisgo.Redisgo, name string, opts ...Option) *Leaderboard {
+	o := options{
+		prefix:    "leaderboard:",
+		windows:   []Window{AllTime},
+		retention: 7 * 24 * time.Hour,
+		loc:       time.Local,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Leaderboard{r: r, name: name, opts: o}
+}
+
+// View 查询时间 t 所在窗口的榜单，AllTime 忽略 t
+func (lb *Leaderboard) View(w Window, t time.Time) *View {
+	v := &View{lb: lb, key: lb.opts.prefix + "{" + lb.name + "}", factor: 1}
+	length := horizon
+	switch w {
+	case AllTime:
+		v.start = epoch
+	case Daily:
+		t = t.In(lb.opts.loc)
+		v.start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, lb.opts.loc)
+		v.end = v.start.AddDate(0, 0, 1)
+	case Weekly:
+		t = t.In(lb.opts.loc)
+		weekday := (int(t.Weekday()) + 6) % 7
+		v.start = time.Date(t.Year(), t.Month(), t.Day()-weekday, 0, 0, 0, 0, lb.opts.loc)
+		v.end = v.start.AddDate(0, 0, 7)
+	}
+	if !v.end.IsZero() {
+		v.key += ":" + w.String() + ":" + v.start.Format("20060102")
+		length = v.end.Sub(v.start)
+	}
+	if lb.opts.tieBreak > 0 {
+		v.factor = float64(uint64(1) << bits.Len64(uint64(length/lb.opts.tieBreak)))
+	}
+	return v
+}
+
+// Current 当前时间所在窗口的榜单
+func (lb *Leaderboard) Current(w Window) *View {
+	return lb.View(w, lb.opts.now())
+}
+
+// View 某个时间窗口的榜单
+type View struct {
+	lb  *Leaderboard
+	key string
+	// start, end 窗口的起止时间，总榜的 end 为零值
+	start, end time.Time
+	// factor 打破平局时分数编码为 score*factor + factor-1-ticks，未开启时为 1
+	factor float64
+}
+
+// Key 保存榜单的 key
+func (v *View) Key() string {
+	return v.key
+}
+
+// MaxScore 开启 WithTieBreak 时分数绝对值的上限，未开启时为 +Inf
+func (v *View) MaxScore() float64 {
+	if v.factor == 1 {
+		return math.Inf(1)
+	}
+	return float64(uint64(1)<<53)/v.factor - 1
+}
+
+// Count 榜单中的成员数
+func (v *View) Count(ctx context.Context) (int, error) {
+	return v.lb.r.ZCard(ctx, v.key)
+}
+
+// Top 返回前 n 名
+func (v *View) Top(ctx context.Context, n int) ([]Entry, error) {
+	return v.list(ctx, 0, n-1)
+}
+
+// Page 按每页 size 个成员分页，page 从 1 开始
+func (v *View) Page(ctx context.Context, page, size int) ([]Entry, error) {
+	if page < 1 || size < 1 {
+		return nil, ErrInvalidPage
+	}
+	return v.list(ctx, (page-1)*size, page*size-1)
+}
+
+// Around 返回 member 以及排在它前后各 n 个成员
+func (v *View) Around(ctx context.Context, member string, n int) ([]Entry, error) {
+	pos, err := redis.Int(v.lb.r.DoCtx(ctx, "ZREVRANK", v.key, member))
+	if err == redis.ErrNil {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	start := pos - n
+	if start < 0 {
+		start = 0
+	}
+	return v.list(ctx, start, pos+n)
+}
+
+// Entry 返回 member 的分数和排名
+func (v *View) Entry(ctx context.Context, member string) (Entry, error) {
+	p := v.lb.r.Pipeline(ctx)
+	score := p.Do("ZSCORE", v.key, member)
+	pos := p.Do("ZREVRANK", v.key, member)
+	if err := p.Exec(); err != nil {
+		return Entry{}, err
+	}
+	if score.Val() == nil {
+		return Entry{}, ErrMemberNotFound
+	}
+
+	encoded, err := redis.Float64(score.Val(), nil)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{Member: member, Score: v.decode(encoded)}
+	if v.lb.opts.ranking == OrdinalRanking {
+		rank, err := redis.Int64(pos.Val(), nil)
+		if err != nil {
+			return Entry{}, err
+		}
+		e.Rank = rank + 1
+		return e, nil
+	}
+	e.Rank, err = v.rank(ctx, e.Score)
+	return e, err
+}
+
+// list 返回排在 [start, stop] 的成员，只有第一个成员的排名需要单独查询，之后的根据分数依次推算
+func (v *View) list(ctx context.Context, start, stop int) ([]Entry, error) {
+	if stop < start {
+		return nil, nil
+	}
+	values, err := v.lb.r.ZRevRangeWithScore(ctx, v.key, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		encoded, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Member: values[i], Score: v.decode(encoded)})
+	}
+	if len(entries) == 0 {
+		return entries, nil
+	}
+
+	rank := int64(start + 1)
+	if v.lb.opts.ranking != OrdinalRanking && start > 0 {
+		if rank, err = v.rank(ctx, entries[0].Score); err != nil {
+			return nil, err
+		}
+	}
+	entries[0].Rank = rank
+	for i := 1; i < len(entries); i++ {
+		switch {
+		case v.lb.opts.ranking == OrdinalRanking:
+			rank = int64(start + i + 1)
+		case entries[i].Score == entries[i-1].Score:
+			// 分数相同沿用上一个排名
+		case v.lb.opts.ranking == DenseRanking:
+			rank++
+		default:
+			rank = int64(start + i + 1)
+		}
+		entries[i].Rank = rank
+	}
+	return entries, nil
+}
+
+// rank 按分数计算 StandardRanking 和 DenseRanking 的排名，即分数更高的成员数或不同分数数加 1
+func (v *View) rank(ctx context.Context, score float64) (int64, error) {
+	key, min := v.key, "("+formatScore(score)
+	if v.lb.opts.ranking == DenseRanking {
+		key = v.key + ":distinct"
+	} else if v.factor > 1 {
+		// 编码后分数为 score 的成员位于 [score*factor, (score+1)*factor)
+		min = formatScore((score + 1) * v.factor)
+	}
+	n, err := redis.Int64(v.lb.r.DoCtx(ctx, "ZCOUNT", key, min, "+inf"))
+	if err != nil {
+		return 0, err
+	}
+	return n + 1, nil
+}
+
+func (v *View) decode(encoded float64) float64 {
+	if v.factor == 1 {
+		return encoded
+	}
+	return math.Floor(encoded / v.factor)
+}
+
+// ticks 打破平局用的时间，越早写入编码后的低位越大
+func (v *View) ticks(now time.Time) float64 {
+	if v.factor == 1 {
+		return 0
+	}
+	ticks := float64(now.Sub(v.start) / v.lb.opts.tieBreak)
+	return math.Max(0, math.Min(ticks, v.factor-1))
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
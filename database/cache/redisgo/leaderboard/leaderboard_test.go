@@ -0,0 +1,282 @@
+package leaderboard
+
+import (
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestViewEncoding(t *testing.T) {
+	lb := New(nil, "t", WithTieBreak(time.Second), WithLocation(time.UTC))
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		window   Window
+		factor   float64
+		maxScore float64
+	}{
+		// 86400 个 tick 需要 17 位
+		{Daily, 1 << 17, 1<<36 - 1},
+		// 604800 个 tick 需要 20 位
+		{Weekly, 1 << 20, 1<<33 - 1},
+		// 100 年约 3.15e9 个 tick 需要 32 位
+		{AllTime, 1 << 32, 1<<21 - 1},
+	}
+	for _, tt := range tests {
+		v := lb.View(tt.window, now)
+		if v.factor != tt.factor {
+			t.Errorf("%s: factor got %v, want %v", tt.window, v.factor, tt.factor)
+		}
+		if v.MaxScore() != tt.maxScore {
+			t.Errorf("%s: max score got %v, want %v", tt.window, v.MaxScore(), tt.maxScore)
+		}
+
+		// 编码方式与 updateScript 相同，分数在上限以内时编码后的值可以精确表示
+		encode := func(score, ticks float64) float64 {
+			return score*v.factor + v.factor - 1 - ticks
+		}
+		for _, score := range []float64{0, 1, -1, 12345, -12345, tt.maxScore, -tt.maxScore} {
+			for _, ticks := range []float64{0, 1, v.factor - 1} {
+				if got := v.decode(encode(score, ticks)); got != score {
+					t.Errorf("%s: decode(%v, ticks %v) got %v", tt.window, score, ticks, got)
+				}
+			}
+			if encode(score, 0) <= encode(score, 1) {
+				t.Errorf("%s: score %v earlier tick should rank higher", tt.window, score)
+			}
+			if encode(score+1, v.factor-1) <= encode(score, 0) {
+				t.Errorf("%s: score %v should rank below %v", tt.window, score, score+1)
+			}
+		}
+	}
+
+	v := lb.View(Daily, now)
+	if got := v.ticks(v.start.Add(10 * time.Second)); got != 10 {
+		t.Errorf("ticks: got %v, want 10", got)
+	}
+	if got := v.ticks(v.start.Add(-time.Hour)); got != 0 {
+		t.Errorf("ticks before start: got %v, want 0", got)
+	}
+	if got := v.ticks(v.start.Add(48 * time.Hour)); got != v.factor-1 {
+		t.Errorf("ticks after end: got %v, want %v", got, v.factor-1)
+	}
+
+	plain := New(nil, "t").View(AllTime, now)
+	if plain.factor != 1 || !math.IsInf(plain.MaxScore(), 1) || plain.decode(-2.5) != -2.5 {
+		t.Errorf("without tie-break: factor %v, max score %v", plain.factor, plain.MaxScore())
+	}
+}
+
+// TestLeaderboard 设置 REDISGO_TEST_ADDR 时对真实的 redis 执行
+func TestLeaderboard(t *testing.T) {
+	addr := os.Getenv("REDISGO_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDISGO_TEST_ADDR not set")
+	}
+	r := redisgo.NewRedisgo(redisgo.WithAddr(addr))
+	defer r.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	newBoard := func(t *testing.T, opts ...Option) *Leaderboard {
+		name := t.Name() + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		lb := New(r, name, append([]Option{WithClock(clock)}, opts...)...)
+		t.Cleanup(func() {
+			for _, w := range []Window{AllTime, Daily, Weekly} {
+				key := lb.View(w, now).Key()
+				r.DoCtx(ctx, "DEL", key, key+":distinct", key+":counts")
+			}
+		})
+		return lb
+	}
+	must := func(t *testing.T, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// expect 按 member:score:rank 比较查询结果
+	expect := func(t *testing.T, entries []Entry, err error, want ...string) {
+		t.Helper()
+		must(t, err)
+		got := make([]string, len(entries))
+		for i, e := range entries {
+			got[i] = e.Member + ":" + formatScore(e.Score) + ":" + strconv.FormatInt(e.Rank, 10)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	}
+	top := func(v *View) ([]Entry, error) {
+		return v.Top(ctx, 10)
+	}
+
+	t.Run("TieBreak", func(t *testing.T) {
+		lb := newBoard(t, WithTieBreak(time.Second))
+		v := lb.Current(AllTime)
+		must(t, lb.Set(ctx, "a", 10))
+		now = now.Add(time.Second)
+		must(t, lb.Set(ctx, "b", 10))
+		entries, err := top(v)
+		expect(t, entries, err, "a:10:1", "b:10:2")
+
+		// 分数没有变化时不改变先后
+		now = now.Add(time.Second)
+		must(t, lb.Set(ctx, "a", 10))
+		_, err = lb.Incr(ctx, "b", 0)
+		must(t, err)
+		entries, err = top(v)
+		expect(t, entries, err, "a:10:1", "b:10:2")
+
+		if score, err := lb.Incr(ctx, "b", 1); err != nil || score != 11 {
+			t.Fatalf("incr: got %v, %v", score, err)
+		}
+		must(t, lb.Set(ctx, "c", -3))
+		entries, err = top(v)
+		expect(t, entries, err, "b:11:1", "a:10:2", "c:-3:3")
+
+		if err := lb.Set(ctx, "d", v.MaxScore()+1); err != ErrScoreOutOfRange {
+			t.Errorf("out of range: got %v", err)
+		}
+		if err := lb.Set(ctx, "d", -v.MaxScore()); err != nil {
+			t.Errorf("min score: %v", err)
+		}
+		if err := lb.Set(ctx, "d", 1.5); err != ErrNonInteger {
+			t.Errorf("non integer: got %v", err)
+		}
+	})
+
+	t.Run("Standard", func(t *testing.T) {
+		lb := newBoard(t, WithTieBreak(time.Second), WithRanking(StandardRanking))
+		v := lb.Current(AllTime)
+		must(t, lb.SetBatch(ctx, map[string]float64{"a": 10, "b": 10, "c": -5}))
+		if e, err := v.Entry(ctx, "c"); err != nil || e.Rank != 3 {
+			t.Fatalf("entry c: got %+v, %v", e, err)
+		}
+		if e, err := v.Entry(ctx, "b"); err != nil || e.Rank != 1 {
+			t.Fatalf("entry b: got %+v, %v", e, err)
+		}
+	})
+
+	t.Run("Dense", func(t *testing.T) {
+		lb := newBoard(t, WithRanking(DenseRanking))
+		v := lb.Current(AllTime)
+		must(t, lb.SetBatch(ctx, map[string]float64{"x": 10, "y": 10, "z": 5, "w": -1}))
+		entries, err := top(v)
+		expect(t, entries, err, "x:10:1", "y:10:1", "z:5:2", "w:-1:3")
+
+		must(t, lb.Set(ctx, "z", 10))
+		if e, err := v.Entry(ctx, "w"); err != nil || e.Rank != 2 {
+			t.Fatalf("entry w: got %+v, %v", e, err)
+		}
+		if n, err := lb.Remove(ctx, "x", "y", "missing"); err != nil || n != 2 {
+			t.Fatalf("remove: got %v, %v", n, err)
+		}
+		// 10 分仍有 z，去重后的分数集合不变
+		if e, err := v.Entry(ctx, "w"); err != nil || e.Rank != 2 {
+			t.Fatalf("entry w after remove: got %+v, %v", e, err)
+		}
+		_, err = lb.Remove(ctx, "z")
+		must(t, err)
+		if e, err := v.Entry(ctx, "w"); err != nil || e.Rank != 1 {
+			t.Fatalf("entry w after removing z: got %+v, %v", e, err)
+		}
+	})
+
+	// 第二页之后的第一个成员单独查询排名，之后的排名依次推算
+	// 同一次写入的成员时间相同，开启 WithTieBreak 时分数相同的成员同样按成员名倒序排列
+	pages := []struct {
+		name    string
+		ranking Ranking
+		page2   []string
+		page3   []string
+		around  []string
+	}{
+		{"Ordinal", OrdinalRanking, []string{"c:40:3", "b:40:4"}, []string{"e:30:5", "f:20:6"}, []string{"c:40:3", "b:40:4", "e:30:5"}},
+		{"Standard", StandardRanking, []string{"c:40:2", "b:40:2"}, []string{"e:30:5", "f:20:6"}, []string{"c:40:2", "b:40:2", "e:30:5"}},
+		{"Dense", DenseRanking, []string{"c:40:2", "b:40:2"}, []string{"e:30:3", "f:20:4"}, []string{"c:40:2", "b:40:2", "e:30:3"}},
+	}
+	for _, tt := range pages {
+		for _, tieBreak := range []time.Duration{0, time.Second} {
+			t.Run("Page"+tt.name+"/"+tieBreak.String(), func(t *testing.T) {
+				lb := newBoard(t, WithRanking(tt.ranking), WithTieBreak(tieBreak))
+				v := lb.Current(AllTime)
+				must(t, lb.SetBatch(ctx, map[string]float64{"a": 50, "b": 40, "c": 40, "d": 40, "e": 30, "f": 20}))
+
+				entries, err := v.Page(ctx, 1, 2)
+				expect(t, entries, err, "a:50:1", "d:40:2")
+				entries, err = v.Page(ctx, 2, 2)
+				expect(t, entries, err, tt.page2...)
+				entries, err = v.Page(ctx, 3, 2)
+				expect(t, entries, err, tt.page3...)
+				entries, err = v.Page(ctx, 4, 2)
+				expect(t, entries, err)
+				if _, err := v.Page(ctx, 0, 2); err != ErrInvalidPage {
+					t.Errorf("page 0: got %v", err)
+				}
+
+				entries, err = v.Around(ctx, "b", 1)
+				expect(t, entries, err, tt.around...)
+				// 排在前面的成员不足 n 个时从第一名开始
+				entries, err = v.Around(ctx, "d", 2)
+				expect(t, entries, err, "a:50:1", "d:40:2", tt.page2[0], tt.page2[1])
+				if _, err := v.Around(ctx, "missing", 1); err != ErrMemberNotFound {
+					t.Errorf("around missing: got %v", err)
+				}
+			})
+		}
+	}
+
+	t.Run("Windows", func(t *testing.T) {
+		now = time.Now()
+		lb := newBoard(t, WithWindows(AllTime, Daily, Weekly), WithLocation(time.UTC), WithRetention(time.Hour))
+		must(t, lb.Set(ctx, "a", 5))
+
+		day := now.UTC()
+		dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		weekStart := dayStart.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		base := lb.View(AllTime, now).Key()
+		tests := []struct {
+			w        Window
+			key      string
+			expireAt time.Time
+		}{
+			{AllTime, base, time.Time{}},
+			{Daily, base + ":daily:" + dayStart.Format("20060102"), dayStart.AddDate(0, 0, 1).Add(time.Hour)},
+			{Weekly, base + ":weekly:" + weekStart.Format("20060102"), weekStart.AddDate(0, 0, 7).Add(time.Hour)},
+		}
+		for _, tt := range tests {
+			v := lb.Current(tt.w)
+			if v.Key() != tt.key {
+				t.Errorf("%s: key got %s, want %s", tt.w, v.Key(), tt.key)
+			}
+			entries, err := top(v)
+			expect(t, entries, err, "a:5:1")
+
+			pttl, err := redis.Int64(r.DoCtx(ctx, "PTTL", v.Key()))
+			must(t, err)
+			if tt.expireAt.IsZero() {
+				if pttl != -1 {
+					t.Errorf("%s: pttl got %d, want -1", tt.w, pttl)
+				}
+				continue
+			}
+			want := time.Until(tt.expireAt)
+			if d := time.Duration(pttl)*time.Millisecond - want; d < -2*time.Second || d > 2*time.Second {
+				t.Errorf("%s: ttl got %v, want %v", tt.w, time.Duration(pttl)*time.Millisecond, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package leaderboard
+
+import (
+	"context"
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 每个窗口使用三个 key: 榜单本身、DenseRanking 去重后的分数集合和每个分数的成员数
+// dense 为 1 时维护后两个 key
+const luaHelpers = `
+local windows = #KEYS / 3
+
+local function decode(encoded, factor)
+	if factor > 1 then
+		return math.floor(encoded / factor)
+	end
+	return encoded
+end
+
+local function fmt(score)
+	return string.format('%.17g', score)
+end
+
+local function dec(w, score)
+	local f = fmt(score)
+	if redis.call('HINCRBY', KEYS[w * 3 + 3], f, -1) <= 0 then
+		redis.call('HDEL', KEYS[w * 3 + 3], f)
+		redis.call('ZREM', KEYS[w * 3 + 2], f)
+	end
+end
+
+local function inc(w, score)
+	local f = fmt(score)
+	if redis.call('HINCRBY', KEYS[w * 3 + 3], f, 1) == 1 then
+		redis.call('ZADD', KEYS[w * 3 + 2], score, f)
+	end
+end
+`
+
+// 先计算所有窗口的新分数，任何一个超出范围时不做修改，返回第一个窗口的新分数
+// 分数没有变化的成员保留原来编码后的分数
+// ARGV: op, dense, n, 每个窗口依次为 factor, ticks, limit, expireat，之后是 n 对 member, value
+var updateScript = redisgo.NewScript(-1, luaHelpers+`
+local op = ARGV[1]
+local dense = ARGV[2] == '1'
+local n = tonumber(ARGV[3])
+local base = 3 + windows * 4
+
+local updates = {}
+for w = 0, windows - 1 do
+	local factor = tonumber(ARGV[w * 4 + 4])
+	local ticks = tonumber(ARGV[w * 4 + 5])
+	local limit = tonumber(ARGV[w * 4 + 6])
+	for i = 1, n do
+		local member = ARGV[base + i * 2 - 1]
+		local new = tonumber(ARGV[base + i * 2])
+		local raw = redis.call('ZSCORE', KEYS[w * 3 + 1], member)
+		local old
+		if raw then
+			old = decode(tonumber(raw), factor)
+			if op == 'incr' then
+				new = old + new
+			end
+		end
+		if limit > 0 and math.abs(new) > limit then
+			return redis.error_reply('OUTOFRANGE ' .. member)
+		end
+		local encoded = new
+		if old == new then
+			-- 分数没有变化时保留原来的时间，不改变平局时的先后
+			encoded = tonumber(raw)
+		elseif factor > 1 then
+			encoded = new * factor + factor - 1 - ticks
+		end
+		updates[#updates + 1] = {w, member, old, new, encoded}
+	end
+end
+
+local res = {}
+for _, u in ipairs(updates) do
+	local w, member, old, new, encoded = u[1], u[2], u[3], u[4], u[5]
+	redis.call('ZADD', KEYS[w * 3 + 1], encoded, member)
+	if dense and old ~= new then
+		if old then
+			dec(w, old)
+		end
+		inc(w, new)
+	end
+	if w == 0 then
+		res[#res + 1] = fmt(new)
+	end
+end
+
+for w = 0, windows - 1 do
+	local expireat = tonumber(ARGV[w * 4 + 7])
+	if expireat > 0 then
+		for k = 1, 3 do
+			redis.call('PEXPIREAT', KEYS[w * 3 + k], expireat)
+		end
+	end
+end
+return res
+`)
+
+// 返回从第一个窗口中删除的成员数
+// ARGV: dense, 每个窗口的 factor, 之后是 member
+var removeScript = redisgo.NewScript(-1, luaHelpers+`
+local dense = ARGV[1] == '1'
+local removed = 0
+for w = 0, windows - 1 do
+	local factor = tonumber(ARGV[w + 2])
+	for i = windows + 2, #ARGV do
+		local old = redis.call('ZSCORE', KEYS[w * 3 + 1], ARGV[i])
+		if old then
+			redis.call('ZREM', KEYS[w * 3 + 1], ARGV[i])
+			if dense then
+				dec(w, decode(tonumber(old), factor))
+			end
+			if w == 0 then
+				removed = removed + 1
+			end
+		end
+	end
+end
+return removed
+`)
+
+// Set 设置 member 的分数
+func (lb *Leaderboard) Set(ctx context.Context, member string, score float64) error {
+	_, err := lb.update(ctx, "set", []string{member}, []float64{score})
+	return err
+}
+
+// Incr 增加 member 的分数，返回第一个窗口中的新分数
+func (lb *Leaderboard) Incr(ctx context.Context, member string, delta float64) (float64, error) {
+	res, err := lb.update(ctx, "incr", []string{member}, []float64{delta})
+	if err != nil {
+		return 0, err
+	}
+	return res[0], nil
+}
+
+// SetBatch 在一次脚本调用中设置多个成员的分数
+func (lb *Leaderboard) SetBatch(ctx context.Context, scores map[string]float64) error {
+	members, values := split(scores)
+	_, err := lb.update(ctx, "set", members, values)
+	return err
+}
+
+// IncrBatch 在一次脚本调用中增加多个成员的分数，返回第一个窗口中的新分数
+func (lb *Leaderboard) IncrBatch(ctx context.Context, deltas map[string]float64) (map[string]float64, error) {
+	members, values := split(deltas)
+	res, err := lb.update(ctx, "incr", members, values)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64, len(members))
+	for i, member := range members {
+		scores[member] = res[i]
+	}
+	return scores, nil
+}
+
+// Remove 从当前所有窗口中删除成员，返回第一个窗口中删除的成员数
+func (lb *Leaderboard) Remove(ctx context.Context, members ...string) (int, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	views := lb.views(lb.opts.now())
+	args := lb.keys(views)
+	args = append(args, lb.dense())
+	for _, v := range views {
+		args = append(args, int64(v.factor))
+	}
+	for _, member := range members {
+		args = append(args, member)
+	}
+	return removeScript.Int(ctx, lb.r, args...)
+}
+
+func (lb *Leaderboard) update(ctx context.Context, op string, members []string, values []float64) ([]float64, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	if lb.opts.tieBreak > 0 {
+		for _, value := range values {
+			if value != math.Trunc(value) {
+				return nil, ErrNonInteger
+			}
+		}
+	}
+
+	now := lb.opts.now()
+	views := lb.views(now)
+	args := lb.keys(views)
+	args = append(args, op, lb.dense(), len(members))
+	for _, v := range views {
+		var limit, expireAt int64
+		if v.factor > 1 {
+			limit = int64(v.MaxScore())
+		}
+		if !v.end.IsZero() {
+			expireAt = v.end.Add(lb.opts.retention).UnixMilli()
+		}
+		args = append(args, int64(v.factor), int64(v.ticks(now)), limit, expireAt)
+	}
+	for i, member := range members {
+		args = append(args, member, values[i])
+	}
+
+	reply, err := updateScript.Strings(ctx, lb.r, args...)
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "OUTOFRANGE ") {
+		return nil, ErrScoreOutOfRange
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]float64, len(reply))
+	for i, s := range reply {
+		if res[i], err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// views 写入时 now 所在的所有窗口
+func (lb *Leaderboard) views(now time.Time) []*View {
+	views := make([]*View, len(lb.opts.windows))
+	for i, w := range lb.opts.windows {
+		views[i] = lb.View(w, now)
+	}
+	return views
+}
+
+// keys 返回 numkeys 和所有窗口的 key，作为脚本参数的开头
+func (lb *Leaderboard) keys(views []*View) []interface{} {
+	args := []interface{}{len(views) * 3}
+	for _, v := range views {
+		args = append(args, v.key, v.key+":distinct", v.key+":counts")
+	}
+	return args
+}
+
+func (lb *Leaderboard) dense() int {
+	if lb.opts.ranking == DenseRanking {
+		return 1
+	}
+	return 0
+}
+
+// split 按成员排序，使同一批数据生成的脚本参数相同
+func split(m map[string]float64) ([]string, []float64) {
+	members := make([]string, 0, len(m))
+	for member := range m {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	values := make([]float64, len(members))
+	for i, member := range members {
+		values[i] = m[member]
+	}
+	return members, values
+}
@@ -0,0 +1,177 @@
+package redisgo
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// negativeValue 缓存"数据不存在"时写入的值
+var negativeValue = []byte("\x00redisgo:nil")
+
+type loadOptions struct {
+	codec        Codec
+	negativeTTL  time.Duration
+	jitter       float64
+	earlyRefresh float64
+	timeout      time.Duration
+}
+
+type LoadOption func(*loadOptions)
+
+// WithLoadCodec 缓存值的序列化方式，默认使用 Redisgo 配置的 Codec
+func WithLoadCodec(c Codec) LoadOption {
+	return func(o *loadOptions) {
+		o.codec = c
+	}
+}
+
+// WithNegativeTTL loader 返回 ErrKeyNoExist 时缓存空结果的时间，为 0 时不缓存空结果
+func WithNegativeTTL(ttl time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithTTLJitter 在 ttl 上随机增加 [0, ttl*jitter) 的时间，避免大量 key 同时过期
+func WithTTLJitter(jitter float64) LoadOption {
+	return func(o *loadOptions) {
+		o.jitter = jitter
+	}
+}
+
+// WithEarlyRefresh 剩余过期时间小于 ttl*window 时，按剩余时间越少概率越大的方式在后台提前刷新
+func WithEarlyRefresh(window float64) LoadOption {
+	return func(o *loadOptions) {
+		o.earlyRefresh = window
+	}
+}
+
+// WithLoadTimeout loader 执行的超时时间，默认 10 秒
+// loader 不受调用方 ctx 取消的影响，调用方取消后仍会继续执行并写入缓存，供其他等待的调用方使用
+func WithLoadTimeout(d time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.timeout = d
+	}
+}
+
+// GetOrLoad 从缓存读取 key，未命中时调用 loader 加载并写入缓存，同一进程内同一个 key 的并发加载只执行一次
+// loader 返回 ErrKeyNoExist 表示数据不存在，结果会按 WithNegativeTTL 缓存，之后的读取直接返回 ErrKeyNoExist
+func GetOrLoad[T any](ctx context.Context, r *Redisgo, key string, ttl time.Duration, loader func(ctx context.Context) (T, error), opts ...LoadOption) (T, error) {
+	o := loadOptions{
+		codec:       r.codec(),
+		negativeTTL: 30 * time.Second,
+		jitter:      0.1,
+		timeout:     10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var res T
+	p := r.Pipeline(ctx)
+	get := p.Get(key)
+	pttl := p.Do("PTTL", key)
+	if err := p.Exec(); err != nil {
+		return res, err
+	}
+
+	if data := get.Val(); data != nil {
+		if bytes.Equal(data, negativeValue) {
+			return res, ErrKeyNoExist
+		}
+		if err := o.codec.Unmarshal(data, &res); err == nil {
+			if remain, ok := pttl.Val().(int64); ok && o.shouldRefresh(time.Duration(remain)*time.Millisecond, ttl) {
+				go load(detachedContext{ctx}, r, key, ttl, loader, &o)
+			}
+			return res, nil
+		}
+		// 无法解析的旧数据当作未命中处理
+	}
+
+	return load(ctx, r, key, ttl, loader, &o)
+}
+
+// load 同一个客户端、前缀、key 和类型的并发加载只执行一次
+// loader 使用不会被取消的 ctx 执行，调用方的 ctx 取消时只结束自己的等待
+func load[T any](ctx context.Context, r *Redisgo, key string, ttl time.Duration, loader func(ctx context.Context) (T, error), o *loadOptions) (T, error) {
+	var res T
+	fn := func() (interface{}, error) {
+		lctx, cancel := context.WithTimeout(detachedContext{ctx}, o.timeout)
+		defer cancel()
+
+		res, err := loader(lctx)
+		if err == ErrKeyNoExist {
+			if o.negativeTTL > 0 {
+				r.do(lctx, "SET", nil, key, negativeValue, "PX", o.negativeTTL.Milliseconds())
+			}
+			return res, err
+		}
+		if err != nil {
+			return res, err
+		}
+
+		data, err := o.codec.Marshal(res)
+		if err != nil {
+			return res, err
+		}
+		// 写缓存失败不影响返回加载的数据
+		r.do(lctx, "SET", nil, key, data, "PX", o.jitterTTL(ttl).Milliseconds())
+		return res, nil
+	}
+
+	ch := r.loads.DoChan(r.prefix+key+"\x00"+reflect.TypeOf(&res).Elem().String(), fn)
+	select {
+	case <-ctx.Done():
+		return res, ctx.Err()
+	case v := <-ch:
+		if v.Val == nil {
+			return res, v.Err
+		}
+		if res, ok := v.Val.(T); ok {
+			return res, v.Err
+		}
+		// 不同包中同名的类型共用了同一次加载，单独执行
+		v.Val, v.Err = fn()
+		res, _ = v.Val.(T)
+		return res, v.Err
+	}
+}
+
+// detachedContext 保留 ctx 中的值，不继承取消和超时，go1.21 之后可以使用 context.WithoutCancel
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (o *loadOptions) jitterTTL(ttl time.Duration) time.Duration {
+	if o.jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(int64(float64(ttl)*o.jitter)+1))
+}
+
+// shouldRefresh 剩余时间进入刷新窗口后，刷新概率从 0 线性增加到 1
+func (o *loadOptions) shouldRefresh(remain, ttl time.Duration) bool {
+	if o.earlyRefresh <= 0 || remain <= 0 {
+		return false
+	}
+	window := time.Duration(float64(ttl) * o.earlyRefresh)
+	if remain >= window {
+		return false
+	}
+	return rand.Float64() < 1-float64(remain)/float64(window)
+}
@@ -0,0 +1,276 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLockNotObtained = errors.New("redis: lock not obtained")
+	ErrLockNotHeld     = errors.New("redis: lock not held")
+	ErrInvalidLockTTL  = errors.New("redis: lock ttl must be at least 1ms")
+	ErrInvalidBackoff  = errors.New("redis: lock backoff must be positive and min <= max")
+)
+
+var (
+	// 加锁成功时自增 fencing token 并返回
+	lockAcquireScript = NewScript(2, `
+if redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2], "NX") then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+	// 只有持有者才能释放
+	lockReleaseScript = NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+	// 只有持有者才能续期
+	lockExtendScript = NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+)
+
+type lockOptions struct {
+	ttl        time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	autoRenew  bool
+}
+
+type LockOption func(*lockOptions)
+
+// WithLockTTL 锁的过期时间，不能小于 1ms
+func WithLockTTL(ttl time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithLockBackoff 阻塞加锁时的重试间隔，每次失败后翻倍，不超过 max，min 必须大于 0
+func WithLockBackoff(min, max time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+// WithLockAutoRenew 是否启动看门狗在 context 有效期内自动续期
+func WithLockAutoRenew(autoRenew bool) LockOption {
+	return func(o *lockOptions) {
+		o.autoRenew = autoRenew
+	}
+}
+
+// Locker 基于 redis 的分布式锁
+type Locker struct {
+	r    *Redisgo
+	opts lockOptions
+}
+
+func NewLocker(r *Redisgo, opts ...LockOption) (*Locker, error) {
+	o := lockOptions{
+		ttl:        10 * time.Second,
+		minBackoff: 10 * time.Millisecond,
+		maxBackoff: 500 * time.Millisecond,
+		autoRenew:  true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// PX 精确到毫秒，看门狗每 ttl/3 续期一次
+	if o.ttl < time.Millisecond {
+		return nil, ErrInvalidLockTTL
+	}
+	if o.minBackoff <= 0 || o.maxBackoff < o.minBackoff {
+		return nil, ErrInvalidBackoff
+	}
+	return &Locker{r: r, opts: o}, nil
+}
+
+// TryLock 尝试加锁一次，锁已被占用时返回 ErrLockNotObtained
+func (l *Locker) TryLock(ctx context.Context, key string) (*Lock, error) {
+	token := uuid.New().String()
+	lockKey, fenceKey := lockKeys(key)
+	fence, err := lockAcquireScript.Int64(ctx, l.r, lockKey, fenceKey, token, l.opts.ttl.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	if fence == 0 {
+		return nil, ErrLockNotObtained
+	}
+
+	lock := &Lock{
+		locker:  l,
+		key:     key,
+		lockKey: lockKey,
+		token:   token,
+		fence:   fence,
+		done:    make(chan struct{}),
+	}
+	if l.opts.autoRenew {
+		var wctx context.Context
+		wctx, lock.cancel = context.WithCancel(ctx)
+		go lock.watchdog(wctx)
+	} else {
+		// 没有续期时超过 ttl 锁一定已经过期
+		lock.expiry = time.AfterFunc(l.opts.ttl, lock.lost)
+	}
+	return lock, nil
+}
+
+// Lock 阻塞直到加锁成功或 ctx 结束
+func (l *Locker) Lock(ctx context.Context, key string) (*Lock, error) {
+	backoff := l.opts.minBackoff
+	for {
+		lock, err := l.TryLock(ctx, key)
+		if err != ErrLockNotObtained {
+			return lock, err
+		}
+
+		// 加入随机抖动，避免多个等待者同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > l.opts.maxBackoff {
+			backoff = l.opts.maxBackoff
+		}
+	}
+}
+
+// Lock 已获取的锁
+type Lock struct {
+	locker *Locker
+	key    string
+	// lockKey redis 中保存锁的 key，见 lockKeys
+	lockKey string
+	token   string
+	fence   int64
+
+	once     sync.Once
+	lostOnce sync.Once
+	cancel   context.CancelFunc
+	expiry   *time.Timer
+	done     chan struct{}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token 持有者的随机标识
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Fence 单调递增的 fencing token，下游写入时携带此值可以拒绝过期持有者的写入
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Done 锁已释放或丢失时关闭：Unlock、续期时发现锁已不再持有，或未开启自动续期时超过 ttl 没有 Extend
+func (l *Lock) Done() <-chan struct{} {
+	return l.done
+}
+
+// Extend 将锁的过期时间重置为 ttl，锁已不再持有时返回 ErrLockNotHeld
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	// PEXPIRE 0 会直接删除 key
+	if ttl < time.Millisecond {
+		return ErrInvalidLockTTL
+	}
+	ok, err := lockExtendScript.Bool(ctx, l.locker.r, l.lockKey, l.token, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.lost()
+		return ErrLockNotHeld
+	}
+	if l.expiry != nil {
+		l.expiry.Reset(ttl)
+	}
+	return nil
+}
+
+// Unlock 释放锁并停止看门狗，锁已过期或被他人持有时返回 ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.stop()
+	ok, err := lockReleaseScript.Bool(ctx, l.locker.r, l.lockKey, l.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (l *Lock) stop() {
+	l.once.Do(func() {
+		if l.cancel != nil {
+			l.cancel()
+			<-l.done
+			return
+		}
+		l.expiry.Stop()
+		l.lost()
+	})
+}
+
+func (l *Lock) lost() {
+	l.lostOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+func (l *Lock) watchdog(ctx context.Context) {
+	defer l.lost()
+
+	ttl := l.locker.opts.ttl
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := l.Extend(ctx, ttl)
+			if err == ErrLockNotHeld {
+				return
+			}
+			// 其他错误在下个周期重试，ttl 内仍有两次机会
+		}
+	}
+}
+
+// lockKeys 返回保存锁和 fencing token 的 key，没有 hash tag 的 key 整体作为 hash tag，
+// 加上 WithKeyPrefix 的前缀之后两个 key 仍然在同一个 slot
+func lockKeys(key string) (lock, fence string) {
+	lock = "{" + key + "}"
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			lock = key
+		}
+	}
+	return lock, lock + ":fence"
+}
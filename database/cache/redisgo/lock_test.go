@@ -0,0 +1,73 @@
+package redisgo
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewLockerOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []LockOption
+		want error
+	}{
+		{"default", nil, nil},
+		{"sub millisecond ttl", []LockOption{WithLockTTL(time.Microsecond)}, ErrInvalidLockTTL},
+		{"zero ttl", []LockOption{WithLockTTL(0)}, ErrInvalidLockTTL},
+		{"zero backoff", []LockOption{WithLockBackoff(0, time.Second)}, ErrInvalidBackoff},
+		{"min above max", []LockOption{WithLockBackoff(time.Second, time.Millisecond)}, ErrInvalidBackoff},
+	}
+	for _, tt := range tests {
+		if _, err := NewLocker(nil, tt.opts...); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestLockDone 设置 REDISGO_TEST_ADDR 时执行，未开启自动续期时 Done 在 Unlock 或超过 ttl 后关闭
+func TestLockDone(t *testing.T) {
+	addr := os.Getenv("REDISGO_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDISGO_TEST_ADDR not set")
+	}
+	r := NewRedisgo(WithAddr(addr))
+	defer r.Close()
+	l, err := NewLocker(r, WithLockTTL(200*time.Millisecond), WithLockAutoRenew(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	lock, err := l.TryLock(ctx, "redisgo:test:lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Done():
+		t.Fatal("done closed while lock is held")
+	default:
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Done():
+	default:
+		t.Fatal("done not closed after unlock")
+	}
+
+	lock, err = l.TryLock(ctx, "redisgo:test:lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lock.Done():
+	case <-time.After(time.Second):
+		t.Fatal("done not closed after ttl")
+	}
+	if err := lock.Unlock(ctx); err != ErrLockNotHeld {
+		t.Fatalf("unlock expired lock: got %v, want ErrLockNotHeld", err)
+	}
+}
@@ -0,0 +1,1543 @@
+package redisgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errMemoryWrongType   = redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errMemoryNotInt      = redis.Error("ERR value is not an integer or out of range")
+	errMemoryNotFloat    = redis.Error("ERR value is not a valid float")
+	errMemorySyntax      = redis.Error("ERR syntax error")
+	errMemoryNotPositive = redis.Error("ERR value is out of range, must be positive")
+)
+
+type memoryList struct {
+	items []string
+}
+
+type memoryZMember struct {
+	member string
+	score  float64
+}
+
+type memoryEntry struct {
+	// string、*memoryList、map[string]string(hash)、map[string]struct{}(set)、map[string]float64(zset)
+	value    interface{}
+	expireAt time.Time
+}
+
+type MemoryOption func(*MemoryClient)
+
+// WithMemoryClock 判断 key 是否过期时使用的时钟，测试中可以替换为手动推进的时钟
+func WithMemoryClock(now func() time.Time) MemoryOption {
+	return func(m *MemoryClient) {
+		m.now = now
+	}
+}
+
+// MemoryClient 进程内实现的 Client，用于不依赖 redis 的单元测试
+// 支持 string、list、hash、set、sorted set 和过期时间，不支持的命令返回 ERR unknown command
+// 过期时间按 WithMemoryClock 的时钟计算，阻塞命令的等待时间使用真实时间
+type MemoryClient struct {
+	commands
+	now func() time.Time
+
+	mu   sync.Mutex
+	data map[string]*memoryEntry
+	// changed 每次执行命令后关闭并重新创建，唤醒等待中的阻塞命令
+	changed chan struct{}
+}
+
+var _ Client = (*MemoryClient)(nil)
+
+func NewMemoryClient(opts ...MemoryOption) *MemoryClient {
+	m := &MemoryClient{
+		now:     time.Now,
+		data:    make(map[string]*memoryEntry),
+		changed: make(chan struct{}),
+	}
+	m.commands = commands{m}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Close 清空所有数据
+func (m *MemoryClient) Close() error {
+	m.FlushAll()
+	return nil
+}
+
+// FlushAll 清空所有数据，用于在测试之间重置状态
+func (m *MemoryClient) FlushAll() {
+	m.mu.Lock()
+	m.data = make(map[string]*memoryEntry)
+	m.mu.Unlock()
+}
+
+// do 与 Redisgo.do 相同，f 转换返回值，redis.ErrNil 不作为错误返回
+func (m *MemoryClient) do(ctx context.Context, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	reply, err = m.exec(strings.ToUpper(cmd), memoryArgs(args))
+	m.notify()
+	m.mu.Unlock()
+
+	if f != nil {
+		reply, err = f(reply, err)
+	}
+	if err == redis.ErrNil {
+		err = nil
+	}
+	return
+}
+
+// doBlocking 以非阻塞的方式执行 BLPOP、BRPOP、BZPOPMIN，没有数据时等待其他命令写入，block 为 0 时一直等待直到 ctx 结束
+func (m *MemoryClient) doBlocking(ctx context.Context, block time.Duration, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
+	var pop string
+	switch strings.ToUpper(cmd) {
+	case "BLPOP":
+		pop = "LPOP"
+	case "BRPOP":
+		pop = "RPOP"
+	case "BZPOPMIN":
+		pop = "ZPOPMIN"
+	default:
+		return nil, redis.Error("ERR unknown command '" + cmd + "'")
+	}
+	if len(args) < 2 {
+		return nil, memoryArity(cmd)
+	}
+	keys := memoryArgs(args[:len(args)-1])
+
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+wait:
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		reply, err = m.popFirst(pop, keys)
+		changed := m.changed
+		m.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if reply != nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			break wait
+		case <-changed:
+		}
+	}
+
+	if f != nil {
+		reply, err = f(reply, err)
+	}
+	if err == redis.ErrNil {
+		err = nil
+	}
+	return
+}
+
+// popFirst 从第一个非空的 key 中取出元素，返回值与阻塞命令相同，第一项为 key，都为空时返回 nil
+func (m *MemoryClient) popFirst(pop string, keys []string) (interface{}, error) {
+	for _, key := range keys {
+		reply, err := m.exec(pop, []string{key})
+		if err != nil {
+			return nil, err
+		}
+		switch v := reply.(type) {
+		case []byte:
+			return []interface{}{[]byte(key), v}, nil
+		case []interface{}:
+			if len(v) > 0 {
+				return append([]interface{}{[]byte(key)}, v...), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryClient) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func memoryArgs(args []interface{}) []string {
+	res := make([]string, 0, len(args))
+	for _, a := range args {
+		res = append(res, memoryArg(a))
+	}
+	return res
+}
+
+// memoryArg 与 redigo 写入参数的格式相同
+func memoryArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	case redis.Argument:
+		return memoryArg(v.RedisArg())
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func memoryArity(cmd string) error {
+	return redis.Error("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
+
+// memoryFloat 按服务端的格式返回浮点数
+func memoryFloat(f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return []byte("inf")
+	case math.IsInf(f, -1):
+		return []byte("-inf")
+	case f != 0 && (math.Abs(f) < 1e-4 || math.Abs(f) >= 1e17):
+		return []byte(strconv.FormatFloat(f, 'g', -1, 64))
+	default:
+		return []byte(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+}
+
+func memoryParseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errMemoryNotFloat
+	}
+	return f, nil
+}
+
+func memoryParseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errMemoryNotInt
+	}
+	return n, nil
+}
+
+// memoryCommand n 为参数的最少个数，不包括命令本身
+type memoryCommand struct {
+	n  int
+	fn func(m *MemoryClient, args []string) (interface{}, error)
+}
+
+var memoryCommands map[string]memoryCommand
+
+func init() {
+	memoryCommands = map[string]memoryCommand{
+		"PING":     {0, (*MemoryClient).ping},
+		"FLUSHALL": {0, (*MemoryClient).flushAll},
+		"FLUSHDB":  {0, (*MemoryClient).flushAll},
+		"DBSIZE":   {0, (*MemoryClient).dbSize},
+		"DEL":      {1, (*MemoryClient).del},
+		"UNLINK":   {1, (*MemoryClient).del},
+		"EXISTS":   {1, (*MemoryClient).exists},
+		"TYPE":     {1, (*MemoryClient).typ},
+		"EXPIRE":   {2, (*MemoryClient).expire},
+		"PEXPIRE":  {2, (*MemoryClient).pexpire},
+		"PERSIST":  {1, (*MemoryClient).persist},
+		"TTL":      {1, (*MemoryClient).ttl},
+		"PTTL":     {1, (*MemoryClient).pttl},
+
+		"GET":         {1, (*MemoryClient).get},
+		"SET":         {2, (*MemoryClient).set},
+		"SETNX":       {2, (*MemoryClient).setNX},
+		"SETEX":       {3, (*MemoryClient).setEX},
+		"PSETEX":      {3, (*MemoryClient).psetEX},
+		"MGET":        {1, (*MemoryClient).mget},
+		"MSET":        {2, (*MemoryClient).mset},
+		"INCR":        {1, (*MemoryClient).incr},
+		"DECR":        {1, (*MemoryClient).decr},
+		"INCRBY":      {2, (*MemoryClient).incrBy},
+		"DECRBY":      {2, (*MemoryClient).decrBy},
+		"INCRBYFLOAT": {2, (*MemoryClient).incrByFloat},
+
+		"LPUSH":  {2, (*MemoryClient).lpush},
+		"RPUSH":  {2, (*MemoryClient).rpush},
+		"LPOP":   {1, (*MemoryClient).lpop},
+		"RPOP":   {1, (*MemoryClient).rpop},
+		"LLEN":   {1, (*MemoryClient).llen},
+		"LRANGE": {3, (*MemoryClient).lrange},
+
+		"HSET":         {3, (*MemoryClient).hset},
+		"HMSET":        {3, (*MemoryClient).hmset},
+		"HSETNX":       {3, (*MemoryClient).hsetNX},
+		"HGET":         {2, (*MemoryClient).hget},
+		"HMGET":        {2, (*MemoryClient).hmget},
+		"HDEL":         {2, (*MemoryClient).hdel},
+		"HEXISTS":      {2, (*MemoryClient).hexists},
+		"HLEN":         {1, (*MemoryClient).hlen},
+		"HGETALL":      {1, (*MemoryClient).hgetAll},
+		"HKEYS":        {1, (*MemoryClient).hkeys},
+		"HVALS":        {1, (*MemoryClient).hvals},
+		"HINCRBY":      {3, (*MemoryClient).hincrBy},
+		"HINCRBYFLOAT": {3, (*MemoryClient).hincrByFloat},
+
+		"SADD":      {2, (*MemoryClient).sadd},
+		"SREM":      {2, (*MemoryClient).srem},
+		"SISMEMBER": {2, (*MemoryClient).sisMember},
+		"SCARD":     {1, (*MemoryClient).scard},
+		"SMEMBERS":  {1, (*MemoryClient).smembers},
+
+		"ZADD":             {3, (*MemoryClient).zadd},
+		"ZINCRBY":          {3, (*MemoryClient).zincrBy},
+		"ZSCORE":           {2, (*MemoryClient).zscore},
+		"ZRANK":            {2, (*MemoryClient).zrank},
+		"ZREVRANK":         {2, (*MemoryClient).zrevRank},
+		"ZREM":             {2, (*MemoryClient).zrem},
+		"ZCARD":            {1, (*MemoryClient).zcard},
+		"ZCOUNT":           {3, (*MemoryClient).zcount},
+		"ZRANGE":           {3, (*MemoryClient).zrange},
+		"ZREVRANGE":        {3, (*MemoryClient).zrevRange},
+		"ZRANGEBYSCORE":    {3, (*MemoryClient).zrangeByScore},
+		"ZREVRANGEBYSCORE": {3, (*MemoryClient).zrevRangeByScore},
+		"ZREMRANGEBYRANK":  {3, (*MemoryClient).zremRangeByRank},
+		"ZREMRANGEBYSCORE": {3, (*MemoryClient).zremRangeByScore},
+		"ZPOPMIN":          {1, (*MemoryClient).zpopMin},
+	}
+}
+
+// exec 执行一条命令，返回值的类型与 redigo 从连接读取的相同，需要持有锁
+func (m *MemoryClient) exec(cmd string, args []string) (interface{}, error) {
+	c, ok := memoryCommands[cmd]
+	if !ok {
+		return nil, redis.Error("ERR unknown command '" + cmd + "'")
+	}
+	if len(args) < c.n {
+		return nil, memoryArity(cmd)
+	}
+	return c.fn(m, args)
+}
+
+// lookup 返回未过期的 key，已过期的 key 在这里删除
+func (m *MemoryClient) lookup(key string) *memoryEntry {
+	e, ok := m.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !m.now().Before(e.expireAt) {
+		delete(m.data, key)
+		return nil
+	}
+	return e
+}
+
+func (m *MemoryClient) getString(key string) (string, bool, error) {
+	e := m.lookup(key)
+	if e == nil {
+		return "", false, nil
+	}
+	s, ok := e.value.(string)
+	if !ok {
+		return "", false, errMemoryWrongType
+	}
+	return s, true, nil
+}
+
+// setString 写入字符串，keepTTL 为 false 时清除过期时间
+func (m *MemoryClient) setString(key, value string, keepTTL bool) {
+	if e := m.lookup(key); e != nil && keepTTL {
+		e.value = value
+		return
+	}
+	m.data[key] = &memoryEntry{value: value}
+}
+
+func (m *MemoryClient) getList(key string, create bool) (*memoryList, error) {
+	e := m.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		l := &memoryList{}
+		m.data[key] = &memoryEntry{value: l}
+		return l, nil
+	}
+	l, ok := e.value.(*memoryList)
+	if !ok {
+		return nil, errMemoryWrongType
+	}
+	return l, nil
+}
+
+func (m *MemoryClient) getHash(key string, create bool) (map[string]string, error) {
+	e := m.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		h := make(map[string]string)
+		m.data[key] = &memoryEntry{value: h}
+		return h, nil
+	}
+	h, ok := e.value.(map[string]string)
+	if !ok {
+		return nil, errMemoryWrongType
+	}
+	return h, nil
+}
+
+func (m *MemoryClient) getSet(key string, create bool) (map[string]struct{}, error) {
+	e := m.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		s := make(map[string]struct{})
+		m.data[key] = &memoryEntry{value: s}
+		return s, nil
+	}
+	s, ok := e.value.(map[string]struct{})
+	if !ok {
+		return nil, errMemoryWrongType
+	}
+	return s, nil
+}
+
+func (m *MemoryClient) getZSet(key string, create bool) (map[string]float64, error) {
+	e := m.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		z := make(map[string]float64)
+		m.data[key] = &memoryEntry{value: z}
+		return z, nil
+	}
+	z, ok := e.value.(map[string]float64)
+	if !ok {
+		return nil, errMemoryWrongType
+	}
+	return z, nil
+}
+
+// deleteIfEmpty 与服务端相同，集合类型的元素全部删除后 key 也被删除
+func (m *MemoryClient) deleteIfEmpty(key string, n int) {
+	if n == 0 {
+		delete(m.data, key)
+	}
+}
+
+/*
+*	key
+ */
+func (m *MemoryClient) ping(args []string) (interface{}, error) {
+	if len(args) > 0 {
+		return []byte(args[0]), nil
+	}
+	return "PONG", nil
+}
+
+func (m *MemoryClient) flushAll(args []string) (interface{}, error) {
+	m.data = make(map[string]*memoryEntry)
+	return "OK", nil
+}
+
+func (m *MemoryClient) dbSize(args []string) (interface{}, error) {
+	n := int64(0)
+	for key := range m.data {
+		if m.lookup(key) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryClient) del(args []string) (interface{}, error) {
+	n := int64(0)
+	for _, key := range args {
+		if m.lookup(key) != nil {
+			delete(m.data, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryClient) exists(args []string) (interface{}, error) {
+	n := int64(0)
+	for _, key := range args {
+		if m.lookup(key) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryClient) typ(args []string) (interface{}, error) {
+	e := m.lookup(args[0])
+	if e == nil {
+		return "none", nil
+	}
+	switch e.value.(type) {
+	case string:
+		return "string", nil
+	case *memoryList:
+		return "list", nil
+	case map[string]string:
+		return "hash", nil
+	case map[string]struct{}:
+		return "set", nil
+	default:
+		return "zset", nil
+	}
+}
+
+func (m *MemoryClient) expireIn(key string, d time.Duration) (interface{}, error) {
+	e := m.lookup(key)
+	if e == nil {
+		return int64(0), nil
+	}
+	if d <= 0 {
+		delete(m.data, key)
+		return int64(1), nil
+	}
+	e.expireAt = m.now().Add(d)
+	return int64(1), nil
+}
+
+func (m *MemoryClient) expire(args []string) (interface{}, error) {
+	sec, err := memoryParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return m.expireIn(args[0], time.Duration(sec)*time.Second)
+}
+
+func (m *MemoryClient) pexpire(args []string) (interface{}, error) {
+	ms, err := memoryParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return m.expireIn(args[0], time.Duration(ms)*time.Millisecond)
+}
+
+func (m *MemoryClient) persist(args []string) (interface{}, error) {
+	e := m.lookup(args[0])
+	if e == nil || e.expireAt.IsZero() {
+		return int64(0), nil
+	}
+	e.expireAt = time.Time{}
+	return int64(1), nil
+}
+
+// remain key 不存在返回 -2，没有过期时间返回 -1
+func (m *MemoryClient) remain(key string) time.Duration {
+	e := m.lookup(key)
+	if e == nil {
+		return -2
+	}
+	if e.expireAt.IsZero() {
+		return -1
+	}
+	return e.expireAt.Sub(m.now())
+}
+
+func (m *MemoryClient) ttl(args []string) (interface{}, error) {
+	d := m.remain(args[0])
+	if d < 0 {
+		return int64(d), nil
+	}
+	// 与服务端相同，按毫秒四舍五入到秒
+	return (d.Milliseconds() + 500) / 1000, nil
+}
+
+func (m *MemoryClient) pttl(args []string) (interface{}, error) {
+	d := m.remain(args[0])
+	if d < 0 {
+		return int64(d), nil
+	}
+	return d.Milliseconds(), nil
+}
+
+/*
+*	string
+ */
+func (m *MemoryClient) get(args []string) (interface{}, error) {
+	s, ok, err := m.getString(args[0])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// set 支持 EX、PX、NX、XX、KEEPTTL
+func (m *MemoryClient) set(args []string) (interface{}, error) {
+	key, value := args[0], args[1]
+	var (
+		ttl             time.Duration
+		nx, xx, keepTTL bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return nil, errMemorySyntax
+			}
+			n, err := memoryParseInt(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if n <= 0 {
+				return nil, redis.Error("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return nil, errMemorySyntax
+		}
+	}
+	if (nx && xx) || (keepTTL && ttl > 0) {
+		return nil, errMemorySyntax
+	}
+
+	exists := m.lookup(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil, nil
+	}
+	m.setString(key, value, keepTTL)
+	if ttl > 0 {
+		m.data[key].expireAt = m.now().Add(ttl)
+	}
+	return "OK", nil
+}
+
+func (m *MemoryClient) setNX(args []string) (interface{}, error) {
+	if m.lookup(args[0]) != nil {
+		return int64(0), nil
+	}
+	m.setString(args[0], args[1], false)
+	return int64(1), nil
+}
+
+func (m *MemoryClient) setEX(args []string) (interface{}, error) {
+	return m.set([]string{args[0], args[2], "EX", args[1]})
+}
+
+func (m *MemoryClient) psetEX(args []string) (interface{}, error) {
+	return m.set([]string{args[0], args[2], "PX", args[1]})
+}
+
+func (m *MemoryClient) mget(args []string) (interface{}, error) {
+	res := make([]interface{}, 0, len(args))
+	for _, key := range args {
+		// 类型不是 string 的 key 返回 nil
+		if s, ok, _ := m.getString(key); ok {
+			res = append(res, []byte(s))
+		} else {
+			res = append(res, nil)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryClient) mset(args []string) (interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, memoryArity("MSET")
+	}
+	for i := 0; i < len(args); i += 2 {
+		m.setString(args[i], args[i+1], false)
+	}
+	return "OK", nil
+}
+
+func (m *MemoryClient) incrString(key string, incr int64) (interface{}, error) {
+	s, ok, err := m.getString(key)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	if ok {
+		if n, err = memoryParseInt(s); err != nil {
+			return nil, err
+		}
+	}
+	if (incr > 0 && n > math.MaxInt64-incr) || (incr < 0 && n < math.MinInt64-incr) {
+		return nil, redis.Error("ERR increment or decrement would overflow")
+	}
+	n += incr
+	m.setString(key, strconv.FormatInt(n, 10), true)
+	return n, nil
+}
+
+func (m *MemoryClient) incr(args []string) (interface{}, error) {
+	return m.incrString(args[0], 1)
+}
+
+func (m *MemoryClient) decr(args []string) (interface{}, error) {
+	return m.incrString(args[0], -1)
+}
+
+func (m *MemoryClient) incrBy(args []string) (interface{}, error) {
+	incr, err := memoryParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return m.incrString(args[0], incr)
+}
+
+func (m *MemoryClient) decrBy(args []string) (interface{}, error) {
+	decr, err := memoryParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return m.incrString(args[0], -decr)
+}
+
+func (m *MemoryClient) incrByFloat(args []string) (interface{}, error) {
+	incr, err := memoryParseFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+	s, ok, err := m.getString(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var f float64
+	if ok {
+		if f, err = memoryParseFloat(s); err != nil {
+			return nil, err
+		}
+	}
+	res := memoryFloat(f + incr)
+	m.setString(args[0], string(res), true)
+	return res, nil
+}
+
+/*
+*	list
+ */
+func (m *MemoryClient) push(args []string, left bool) (interface{}, error) {
+	l, err := m.getList(args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range args[1:] {
+		if left {
+			l.items = append([]string{v}, l.items...)
+		} else {
+			l.items = append(l.items, v)
+		}
+	}
+	return int64(len(l.items)), nil
+}
+
+func (m *MemoryClient) lpush(args []string) (interface{}, error) {
+	return m.push(args, true)
+}
+
+func (m *MemoryClient) rpush(args []string) (interface{}, error) {
+	return m.push(args, false)
+}
+
+func (m *MemoryClient) pop(key string, left bool) (interface{}, error) {
+	l, err := m.getList(key, false)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	var v string
+	if left {
+		v, l.items = l.items[0], l.items[1:]
+	} else {
+		v, l.items = l.items[len(l.items)-1], l.items[:len(l.items)-1]
+	}
+	m.deleteIfEmpty(key, len(l.items))
+	return []byte(v), nil
+}
+
+func (m *MemoryClient) lpop(args []string) (interface{}, error) {
+	return m.pop(args[0], true)
+}
+
+func (m *MemoryClient) rpop(args []string) (interface{}, error) {
+	return m.pop(args[0], false)
+}
+
+func (m *MemoryClient) llen(args []string) (interface{}, error) {
+	l, err := m.getList(args[0], false)
+	if err != nil || l == nil {
+		return int64(0), err
+	}
+	return int64(len(l.items)), nil
+}
+
+func (m *MemoryClient) lrange(args []string) (interface{}, error) {
+	l, err := m.getList(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	if l == nil {
+		return res, nil
+	}
+	start, stop, err := memoryRange(args[1], args[2], len(l.items))
+	if err != nil {
+		return nil, err
+	}
+	for i := start; i <= stop; i++ {
+		res = append(res, []byte(l.items[i]))
+	}
+	return res, nil
+}
+
+// memoryRange 与服务端相同处理负数下标和越界，stop 小于 start 时范围为空
+func memoryRange(startArg, stopArg string, n int) (start, stop int, err error) {
+	s, err := memoryParseInt(startArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	e, err := memoryParseInt(stopArg)
+	if err != nil {
+		return 0, 0, err
+	}
+	start, stop = int(s), int(e)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, -1, nil
+	}
+	return start, stop, nil
+}
+
+/*
+*	hash
+ */
+func (m *MemoryClient) hset(args []string) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, memoryArity("HSET")
+	}
+	h, err := m.getHash(args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(0)
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	return n, nil
+}
+
+func (m *MemoryClient) hmset(args []string) (interface{}, error) {
+	if _, err := m.hset(args); err != nil {
+		return nil, err
+	}
+	return "OK", nil
+}
+
+func (m *MemoryClient) hsetNX(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(0), nil
+	}
+	h[args[1]] = args[2]
+	return int64(1), nil
+}
+
+func (m *MemoryClient) hget(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := h[args[1]]; ok {
+		return []byte(v), nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryClient) hmget(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, 0, len(args)-1)
+	for _, field := range args[1:] {
+		if v, ok := h[field]; ok {
+			res = append(res, []byte(v))
+		} else {
+			res = append(res, nil)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryClient) hdel(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil || h == nil {
+		return int64(0), err
+	}
+	n := int64(0)
+	for _, field := range args[1:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			n++
+		}
+	}
+	m.deleteIfEmpty(args[0], len(h))
+	return n, nil
+}
+
+func (m *MemoryClient) hexists(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func (m *MemoryClient) hlen(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	return int64(len(h)), nil
+}
+
+// sortedFields 服务端返回的顺序不固定，这里按 field 排序使结果稳定
+func sortedFields(h map[string]string) []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (m *MemoryClient) hgetAll(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, 0, len(h)*2)
+	for _, f := range sortedFields(h) {
+		res = append(res, []byte(f), []byte(h[f]))
+	}
+	return res, nil
+}
+
+func (m *MemoryClient) hkeys(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, 0, len(h))
+	for _, f := range sortedFields(h) {
+		res = append(res, []byte(f))
+	}
+	return res, nil
+}
+
+func (m *MemoryClient) hvals(args []string) (interface{}, error) {
+	h, err := m.getHash(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, 0, len(h))
+	for _, f := range sortedFields(h) {
+		res = append(res, []byte(h[f]))
+	}
+	return res, nil
+}
+
+func (m *MemoryClient) hincrBy(args []string) (interface{}, error) {
+	incr, err := memoryParseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+	h, err := m.getHash(args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	if v, ok := h[args[1]]; ok {
+		if n, err = memoryParseInt(v); err != nil {
+			return nil, redis.Error("ERR hash value is not an integer")
+		}
+	}
+	n += incr
+	h[args[1]] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (m *MemoryClient) hincrByFloat(args []string) (interface{}, error) {
+	incr, err := memoryParseFloat(args[2])
+	if err != nil {
+		return nil, err
+	}
+	h, err := m.getHash(args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	var f float64
+	if v, ok := h[args[1]]; ok {
+		if f, err = memoryParseFloat(v); err != nil {
+			return nil, redis.Error("ERR hash value is not a float")
+		}
+	}
+	res := memoryFloat(f + incr)
+	h[args[1]] = string(res)
+	return res, nil
+}
+
+/*
+*	set
+ */
+func (m *MemoryClient) sadd(args []string) (interface{}, error) {
+	s, err := m.getSet(args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(0)
+	for _, member := range args[1:] {
+		if _, ok := s[member]; !ok {
+			s[member] = struct{}{}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryClient) srem(args []string) (interface{}, error) {
+	s, err := m.getSet(args[0], false)
+	if err != nil || s == nil {
+		return int64(0), err
+	}
+	n := int64(0)
+	for _, member := range args[1:] {
+		if _, ok := s[member]; ok {
+			delete(s, member)
+			n++
+		}
+	}
+	m.deleteIfEmpty(args[0], len(s))
+	return n, nil
+}
+
+func (m *MemoryClient) sisMember(args []string) (interface{}, error) {
+	s, err := m.getSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s[args[1]]; ok {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func (m *MemoryClient) scard(args []string) (interface{}, error) {
+	s, err := m.getSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	return int64(len(s)), nil
+}
+
+// smembers 按成员排序返回，服务端返回的顺序不固定
+func (m *MemoryClient) smembers(args []string) (interface{}, error) {
+	s, err := m.getSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(s))
+	for member := range s {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	res := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		res = append(res, []byte(member))
+	}
+	return res, nil
+}
+
+/*
+*	sorted set
+ */
+
+// sortedZSet 按分数排序，分数相同时按成员的字节序排序
+func sortedZSet(z map[string]float64) []memoryZMember {
+	res := make([]memoryZMember, 0, len(z))
+	for member, score := range z {
+		res = append(res, memoryZMember{member: member, score: score})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].score != res[j].score {
+			return res[i].score < res[j].score
+		}
+		return res[i].member < res[j].member
+	})
+	return res
+}
+
+// zadd 支持 NX、XX、GT、LT、CH、INCR
+func (m *MemoryClient) zadd(args []string) (interface{}, error) {
+	key := args[0]
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (incr && len(pairs) != 2) {
+		return nil, errMemorySyntax
+	}
+	if (nx && xx) || (nx && (gt || lt)) || (gt && lt) {
+		return nil, redis.Error("ERR XX, NX, GT, and LT options at the same time are not compatible")
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		f, err := memoryParseFloat(pairs[j])
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, f)
+	}
+
+	z, err := m.getZSet(key, !xx)
+	if err != nil {
+		return nil, err
+	}
+	if z == nil {
+		if incr {
+			return nil, nil
+		}
+		return int64(0), nil
+	}
+
+	var added, changed int64
+	var last interface{}
+	for j, score := range scores {
+		member := pairs[j*2+1]
+		old, exists := z[member]
+		if (nx && exists) || (xx && !exists) {
+			last = nil
+			continue
+		}
+		if incr && exists {
+			score += old
+		}
+		if exists && ((gt && score <= old) || (lt && score >= old)) {
+			last = nil
+			continue
+		}
+		z[member] = score
+		last = memoryFloat(score)
+		if !exists {
+			added++
+		} else if old != score {
+			changed++
+		}
+	}
+	m.deleteIfEmpty(key, len(z))
+	if incr {
+		return last, nil
+	}
+	if ch {
+		return added + changed, nil
+	}
+	return added, nil
+}
+
+func (m *MemoryClient) zincrBy(args []string) (interface{}, error) {
+	return m.zadd([]string{args[0], "INCR", args[1], args[2]})
+}
+
+func (m *MemoryClient) zscore(args []string) (interface{}, error) {
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if score, ok := z[args[1]]; ok {
+		return memoryFloat(score), nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryClient) rank(args []string, rev bool) (interface{}, error) {
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := z[args[1]]; !ok {
+		return nil, nil
+	}
+	sorted := sortedZSet(z)
+	for i, e := range sorted {
+		if e.member == args[1] {
+			if rev {
+				return int64(len(sorted) - 1 - i), nil
+			}
+			return int64(i), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryClient) zrank(args []string) (interface{}, error) {
+	return m.rank(args, false)
+}
+
+func (m *MemoryClient) zrevRank(args []string) (interface{}, error) {
+	return m.rank(args, true)
+}
+
+func (m *MemoryClient) zrem(args []string) (interface{}, error) {
+	z, err := m.getZSet(args[0], false)
+	if err != nil || z == nil {
+		return int64(0), err
+	}
+	n := int64(0)
+	for _, member := range args[1:] {
+		if _, ok := z[member]; ok {
+			delete(z, member)
+			n++
+		}
+	}
+	m.deleteIfEmpty(args[0], len(z))
+	return n, nil
+}
+
+func (m *MemoryClient) zcard(args []string) (interface{}, error) {
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	return int64(len(z)), nil
+}
+
+// memoryScoreBound 解析分数区间，支持 -inf、+inf 和表示开区间的 (
+type memoryScoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (memoryScoreBound, error) {
+	b := memoryScoreBound{}
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	f, err := memoryParseFloat(s)
+	if err != nil {
+		return b, redis.Error("ERR min or max is not a float")
+	}
+	b.value = f
+	return b, nil
+}
+
+func (b memoryScoreBound) aboveMin(score float64) bool {
+	if b.exclusive {
+		return score > b.value
+	}
+	return score >= b.value
+}
+
+func (b memoryScoreBound) belowMax(score float64) bool {
+	if b.exclusive {
+		return score < b.value
+	}
+	return score <= b.value
+}
+
+func (m *MemoryClient) zcount(args []string) (interface{}, error) {
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(0)
+	for _, score := range z {
+		if min.aboveMin(score) && max.belowMax(score) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func zsetReply(members []memoryZMember, withScores bool) []interface{} {
+	res := make([]interface{}, 0, len(members))
+	for _, e := range members {
+		res = append(res, []byte(e.member))
+		if withScores {
+			res = append(res, memoryFloat(e.score))
+		}
+	}
+	return res
+}
+
+// zrangeByRank ZRANGE、ZREVRANGE 只支持按下标的形式和 WITHSCORES
+func (m *MemoryClient) zrangeByRank(args []string, rev bool) (interface{}, error) {
+	withScores := false
+	for _, a := range args[3:] {
+		if !strings.EqualFold(a, "WITHSCORES") {
+			return nil, errMemorySyntax
+		}
+		withScores = true
+	}
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	sorted := sortedZSet(z)
+	start, stop, err := memoryRange(args[1], args[2], len(sorted))
+	if err != nil {
+		return nil, err
+	}
+	if rev {
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+	if start > stop {
+		return []interface{}{}, nil
+	}
+	return zsetReply(sorted[start:stop+1], withScores), nil
+}
+
+func (m *MemoryClient) zrange(args []string) (interface{}, error) {
+	return m.zrangeByRank(args, false)
+}
+
+func (m *MemoryClient) zrevRange(args []string) (interface{}, error) {
+	return m.zrangeByRank(args, true)
+}
+
+func (m *MemoryClient) zrangeByScore(args []string) (interface{}, error) {
+	return m.rangeByScore(args, false)
+}
+
+func (m *MemoryClient) zrevRangeByScore(args []string) (interface{}, error) {
+	return m.rangeByScore(args, true)
+}
+
+// rangeByScore rev 为 true 时参数顺序为 max min，支持 WITHSCORES 和 LIMIT offset count
+func (m *MemoryClient) rangeByScore(args []string, rev bool) (interface{}, error) {
+	minArg, maxArg := args[1], args[2]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	min, err := parseScoreBound(minArg)
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(maxArg)
+	if err != nil {
+		return nil, err
+	}
+
+	withScores := false
+	offset, count := int64(0), int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, errMemorySyntax
+			}
+			if offset, err = memoryParseInt(args[i+1]); err != nil {
+				return nil, err
+			}
+			if count, err = memoryParseInt(args[i+2]); err != nil {
+				return nil, err
+			}
+			i += 2
+		default:
+			return nil, errMemorySyntax
+		}
+	}
+
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	sorted := sortedZSet(z)
+	if rev {
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+	matched := make([]memoryZMember, 0)
+	for _, e := range sorted {
+		if min.aboveMin(e.score) && max.belowMax(e.score) {
+			matched = append(matched, e)
+		}
+	}
+	if offset < 0 {
+		return []interface{}{}, nil
+	}
+	if offset >= int64(len(matched)) {
+		matched = nil
+	} else {
+		matched = matched[offset:]
+	}
+	if count >= 0 && count < int64(len(matched)) {
+		matched = matched[:count]
+	}
+	return zsetReply(matched, withScores), nil
+}
+
+func (m *MemoryClient) zremRangeByRank(args []string) (interface{}, error) {
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	sorted := sortedZSet(z)
+	start, stop, err := memoryRange(args[1], args[2], len(sorted))
+	if err != nil {
+		return nil, err
+	}
+	n := int64(0)
+	for i := start; i <= stop; i++ {
+		delete(z, sorted[i].member)
+		n++
+	}
+	if z != nil {
+		m.deleteIfEmpty(args[0], len(z))
+	}
+	return n, nil
+}
+
+func (m *MemoryClient) zremRangeByScore(args []string) (interface{}, error) {
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	z, err := m.getZSet(args[0], false)
+	if err != nil || z == nil {
+		return int64(0), err
+	}
+	n := int64(0)
+	for member, score := range z {
+		if min.aboveMin(score) && max.belowMax(score) {
+			delete(z, member)
+			n++
+		}
+	}
+	m.deleteIfEmpty(args[0], len(z))
+	return n, nil
+}
+
+// zpopMin 不带 count 时只取出一个成员，返回 [member, score]，key 不存在时返回空数组
+func (m *MemoryClient) zpopMin(args []string) (interface{}, error) {
+	count := int64(1)
+	if len(args) > 1 {
+		var err error
+		if count, err = memoryParseInt(args[1]); err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, errMemoryNotPositive
+		}
+	}
+	z, err := m.getZSet(args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	sorted := sortedZSet(z)
+	if count < int64(len(sorted)) {
+		sorted = sorted[:count]
+	}
+	for _, e := range sorted {
+		delete(z, e.member)
+	}
+	if z != nil {
+		m.deleteIfEmpty(args[0], len(z))
+	}
+	return zsetReply(sorted, true), nil
+}
@@ -0,0 +1,22 @@
+package redisgo_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/aloeproject/toolbox/database/cache/redisgo/redistest"
+)
+
+func TestMemoryClient(t *testing.T) {
+	redistest.Run(t, redistest.Memory)
+}
+
+// TestRedisgo 设置 REDISGO_TEST_ADDR 时对真实的 redis 执行同一组用例，确保 MemoryClient 与 Redisgo 行为一致
+func TestRedisgo(t *testing.T) {
+	addr := os.Getenv("REDISGO_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDISGO_TEST_ADDR not set")
+	}
+	redistest.Run(t, redistest.Redis(redisgo.WithAddr(addr)))
+}
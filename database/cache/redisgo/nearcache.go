@@ -0,0 +1,268 @@
+package redisgo
+
+import (
+	"container/list"
+	"context"
+	"github.com/google/uuid"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NearCacheStats 本地缓存的统计信息
+type NearCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Size          int
+	HitRate       float64
+}
+
+type nearEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+type nearCacheOptions struct {
+	size    int
+	ttl     time.Duration
+	channel string
+}
+
+type NearCacheOption func(*nearCacheOptions)
+
+// WithNearCacheSize 本地最多缓存的 key 数量，超过后淘汰最久未使用的 key
+func WithNearCacheSize(size int) NearCacheOption {
+	return func(o *nearCacheOptions) {
+		o.size = size
+	}
+}
+
+// WithNearCacheTTL 本地缓存的最长过期时间，即失效消息丢失时读到旧数据的最长时间
+// key 在 redis 中的剩余过期时间更短时使用剩余时间
+func WithNearCacheTTL(ttl time.Duration) NearCacheOption {
+	return func(o *nearCacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithNearCacheChannel 广播失效消息的频道，使用同一份数据的实例需要配置相同的频道
+func WithNearCacheChannel(channel string) NearCacheOption {
+	return func(o *nearCacheOptions) {
+		o.channel = channel
+	}
+}
+
+// NearCache 在 Redisgo 之前增加一层进程内的 LRU 缓存
+// 通过 NearCache 写入或删除 key 时，会通过 pub/sub 通知其他实例删除本地缓存
+type NearCache struct {
+	r    *Redisgo
+	id   string
+	opts nearCacheOptions
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	invalidations uint64
+
+	sub *Subscriber
+}
+
+func NewNearCache(ctx context.Context, r *Redisgo, opts ...NearCacheOption) (*NearCache, error) {
+	o := nearCacheOptions{
+		size:    10000,
+		ttl:     time.Minute,
+		channel: "redisgo:nearcache:invalidate",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &NearCache{
+		r:     r,
+		id:    uuid.New().String(),
+		opts:  o,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+
+	// 重连期间的失效消息已经丢失，清空本地缓存
+	sub, err := r.subscribe(ctx, []string{o.channel}, nil, c.onInvalidate, c.flushLocal)
+	if err != nil {
+		return nil, err
+	}
+	c.sub = sub
+	return c, nil
+}
+
+// Get 优先读取本地缓存，未命中时从 redis 读取，key 不存在时返回 nil
+// 返回的 []byte 是副本，修改它不会影响缓存
+func (c *NearCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if v, ok := c.getLocal(key); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return v, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	p := c.r.Pipeline(ctx)
+	get := p.Get(key)
+	pttl := p.Do("PTTL", key)
+	if err := p.Exec(); err != nil {
+		return nil, err
+	}
+	v := get.Val()
+	if v == nil {
+		return nil, nil
+	}
+	// -1 表示没有设置过期时间，-2 表示两条命令之间 key 已经过期
+	if remain, ok := pttl.Val().(int64); ok && remain != -2 {
+		c.setLocal(key, v, time.Duration(remain)*time.Millisecond)
+	}
+	return v, nil
+}
+
+// Set 写入 redis 和本地缓存，并通知其他实例删除本地缓存
+func (c *NearCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{key, value}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	if _, err := c.r.do(ctx, "SET", nil, args...); err != nil {
+		return err
+	}
+	c.setLocal(key, value, ttl)
+	return c.publish(ctx, key)
+}
+
+// Del 删除 redis 和本地缓存，并通知其他实例删除本地缓存
+func (c *NearCache) Del(ctx context.Context, keys ...string) (int, error) {
+	args := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	n, err := c.r.Del(ctx, args...)
+	if err != nil {
+		return n, err
+	}
+	c.removeLocal(keys...)
+	return n, c.publish(ctx, keys...)
+}
+
+// Invalidate 通知所有实例删除本地缓存，用于绕过 NearCache 直接修改了 redis 的场景
+func (c *NearCache) Invalidate(ctx context.Context, keys ...string) error {
+	c.removeLocal(keys...)
+	return c.publish(ctx, keys...)
+}
+
+func (c *NearCache) Stats() NearCacheStats {
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+
+	s := NearCacheStats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Evictions:     atomic.LoadUint64(&c.evictions),
+		Invalidations: atomic.LoadUint64(&c.invalidations),
+		Size:          size,
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// Close 停止接收失效消息并清空本地缓存
+func (c *NearCache) Close() error {
+	err := c.sub.Close()
+	c.mu.Lock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.mu.Unlock()
+	return err
+}
+
+func (c *NearCache) getLocal(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*nearEntry)
+	if time.Now().After(e.expireAt) {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return append([]byte(nil), e.value...), true
+}
+
+// setLocal ttl 为 redis 中的过期时间，小于等于 0 时表示没有过期时间，本地缓存不会超过 opts.ttl
+func (c *NearCache) setLocal(key string, value []byte, ttl time.Duration) {
+	if ttl <= 0 || ttl > c.opts.ttl {
+		ttl = c.opts.ttl
+	}
+	value = append([]byte(nil), value...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*nearEntry)
+		e.value, e.expireAt = value, expireAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&nearEntry{key: key, value: value, expireAt: expireAt})
+	for c.opts.size > 0 && c.ll.Len() > c.opts.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*nearEntry).key)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+func (c *NearCache) flushLocal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	atomic.AddUint64(&c.invalidations, uint64(c.ll.Len()))
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+func (c *NearCache) removeLocal(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		if elem, ok := c.items[k]; ok {
+			c.ll.Remove(elem)
+			delete(c.items, k)
+			atomic.AddUint64(&c.invalidations, 1)
+		}
+	}
+}
+
+// 失效消息格式: 实例id + "\n" + 以 "\n" 分隔的 key
+func (c *NearCache) publish(ctx context.Context, keys ...string) error {
+	_, err := c.r.Publish(ctx, c.opts.channel, c.id+"\n"+strings.Join(keys, "\n"))
+	return err
+}
+
+func (c *NearCache) onInvalidate(msg Message) {
+	parts := strings.Split(string(msg.Data), "\n")
+	// 自己发出的消息，本地缓存已经更新
+	if len(parts) < 2 || parts[0] == c.id {
+		return
+	}
+	c.removeLocal(parts[1:]...)
+}
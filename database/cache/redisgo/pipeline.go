@@ -0,0 +1,325 @@
+package redisgo
+
+import (
+	"context"
+	"github.com/gomodule/redigo/redis"
+	"time"
+)
+
+type pipeCmd struct {
+	name  string
+	args  []interface{}
+	f     func(interface{}, error) (interface{}, error)
+	reply interface{}
+	err   error
+}
+
+// PipeResult 管道中单条命令的结果，需在 Exec 执行之后读取
+type PipeResult[T any] struct {
+	c *pipeCmd
+}
+
+func (p *PipeResult[T]) Result() (res T, err error) {
+	if p.c.err != nil {
+		return res, p.c.err
+	}
+	if p.c.reply != nil {
+		res, _ = p.c.reply.(T)
+	}
+	return
+}
+
+func (p *PipeResult[T]) Val() T {
+	res, _ := p.Result()
+	return res
+}
+
+func (p *PipeResult[T]) Err() error {
+	return p.c.err
+}
+
+// cmdQueue 缓存待发送的命令，Pipeline 和事务共用
+type cmdQueue struct {
+	cmds []*pipeCmd
+}
+
+func (q *cmdQueue) add(cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) *pipeCmd {
+	c := &pipeCmd{name: cmd, args: args, f: f}
+	q.cmds = append(q.cmds, c)
+	return c
+}
+
+func (q *cmdQueue) Len() int {
+	return len(q.cmds)
+}
+
+// Do 将任意命令加入队列，返回原始的 reply
+func (q *cmdQueue) Do(cmd string, args ...interface{}) *PipeResult[interface{}] {
+	return &PipeResult[interface{}]{q.add(cmd, nil, args...)}
+}
+
+func (q *cmdQueue) Set(key, value interface{}) *PipeResult[string] {
+	return &PipeResult[string]{q.add("SET", redisString, key, value)}
+}
+
+func (q *cmdQueue) SetExSecond(key, value interface{}, dur int) *PipeResult[string] {
+	return &PipeResult[string]{q.add("SET", redisString, key, value, "EX", dur)}
+}
+
+func (q *cmdQueue) SetNX(key string, value interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("SETNX", redisInt, key, value)}
+}
+
+func (q *cmdQueue) Get(key string) *PipeResult[[]byte] {
+	return &PipeResult[[]byte]{q.add("GET", redisBytes, key)}
+}
+
+func (q *cmdQueue) GetString(key string) *PipeResult[string] {
+	return &PipeResult[string]{q.add("GET", redisString, key)}
+}
+
+func (q *cmdQueue) GetInt64(key string) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("GET", redisInt64, key)}
+}
+
+func (q *cmdQueue) Del(args ...interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("DEL", redisInt, args...)}
+}
+
+func (q *cmdQueue) Exists(key string) *PipeResult[bool] {
+	return &PipeResult[bool]{q.add("EXISTS", redisBool, key)}
+}
+
+func (q *cmdQueue) Expire(key string, expire time.Duration) *PipeResult[bool] {
+	return &PipeResult[bool]{q.add("EXPIRE", redisBool, key, int64(expire.Seconds()))}
+}
+
+func (q *cmdQueue) TTL(key string) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("TTL", redisInt64, key)}
+}
+
+func (q *cmdQueue) Incr(key string) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("INCR", redisInt64, key)}
+}
+
+func (q *cmdQueue) Incrby(key string, incr int) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("INCRBY", redisInt64, key, incr)}
+}
+
+func (q *cmdQueue) LPush(name string, fields ...interface{}) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("LPUSH", redisInt64, append([]interface{}{name}, fields...)...)}
+}
+
+func (q *cmdQueue) Send(name string, fields ...interface{}) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("RPUSH", redisInt64, append([]interface{}{name}, fields...)...)}
+}
+
+func (q *cmdQueue) HSet(key, fieldk string, fieldv interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("HSET", redisInt, key, fieldk, fieldv)}
+}
+
+func (q *cmdQueue) HGet(key, field string) *PipeResult[string] {
+	return &PipeResult[string]{q.add("HGET", redisString, key, field)}
+}
+
+func (q *cmdQueue) HDel(key interface{}, fields ...interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("HDEL", redisInt, append([]interface{}{key}, fields...)...)}
+}
+
+func (q *cmdQueue) HMSet(key string, fields ...interface{}) *PipeResult[string] {
+	return &PipeResult[string]{q.add("HMSET", redisString, append([]interface{}{key}, fields...)...)}
+}
+
+func (q *cmdQueue) HGetAll(key string) *PipeResult[map[string]string] {
+	return &PipeResult[map[string]string]{q.add("HGETALL", redisStringMap, key)}
+}
+
+func (q *cmdQueue) HIncrby(key, field string, incr int) *PipeResult[int64] {
+	return &PipeResult[int64]{q.add("HINCRBY", redisInt64, key, field, incr)}
+}
+
+func (q *cmdQueue) SAdd(key string, members ...interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("SADD", redisInt, append([]interface{}{key}, members...)...)}
+}
+
+func (q *cmdQueue) SRem(key string, members ...interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("SREM", redisInt, append([]interface{}{key}, members...)...)}
+}
+
+func (q *cmdQueue) SIsMember(key string, member string) *PipeResult[bool] {
+	return &PipeResult[bool]{q.add("SISMEMBER", redisBool, key, member)}
+}
+
+func (q *cmdQueue) SMembers(key string) *PipeResult[[]string] {
+	return &PipeResult[[]string]{q.add("SMEMBERS", redisStrings, key)}
+}
+
+func (q *cmdQueue) ZAdd(key string, args ...interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("ZADD", redisInt, append([]interface{}{key}, args...)...)}
+}
+
+func (q *cmdQueue) ZIncrby(key string, incr int, member string) *PipeResult[int] {
+	return &PipeResult[int]{q.add("ZINCRBY", redisInt, key, incr, member)}
+}
+
+func (q *cmdQueue) ZRem(key string, members ...interface{}) *PipeResult[int] {
+	return &PipeResult[int]{q.add("ZREM", redisInt, append([]interface{}{key}, members...)...)}
+}
+
+func (q *cmdQueue) ZScore(key, member string) *PipeResult[float64] {
+	return &PipeResult[float64]{q.add("ZSCORE", redisFloat64, key, member)}
+}
+
+func (q *cmdQueue) ZRange(key string, args ...interface{}) *PipeResult[[]string] {
+	return &PipeResult[[]string]{q.add("ZRANGE", redisStrings, append([]interface{}{key}, args...)...)}
+}
+
+// Pipeline 将多条命令通过同一个连接一次性发送，减少网络往返
+// 用法:
+//
+//	p := r.Pipeline(ctx)
+//	a := p.HSet(key, "f", 1)
+//	b := p.Expire(key, time.Minute)
+//	if err := p.Exec(); err != nil { ... }
+//	n, err := a.Result()
+type Pipeline struct {
+	cmdQueue
+	ctx context.Context
+	r   *Redisgo
+}
+
+func (r *Redisgo) Pipeline(ctx context.Context) *Pipeline {
+	return &Pipeline{ctx: ctx, r: r}
+}
+
+// Pipelined 创建管道，在 fn 中加入命令后立即执行
+func (r *Redisgo) Pipelined(ctx context.Context, fn func(p *Pipeline)) error {
+	p := r.Pipeline(ctx)
+	fn(p)
+	return p.Exec()
+}
+
+// Exec 发送队列中的全部命令，执行后清空队列，Pipeline 可继续复用
+// 返回连接错误或第一条命令的错误，每条命令的结果通过对应的 PipeResult 获取
+func (p *Pipeline) Exec() error {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil
+	}
+	return p.r.execPipeline(p.ctx, cmds)
+}
+
+func (r *Redisgo) execPipeline(ctx context.Context, cmds []*pipeCmd) (err error) {
+	if err = r.prefixCmds(cmds); err != nil {
+		return err
+	}
+	ctx, span := r.telemetry.startPipeline(ctx, "PIPELINE", cmds)
+	defer func(start time.Time) {
+		r.telemetry.end(ctx, span, "PIPELINE", start, err)
+	}(time.Now())
+
+	return r.processPipelineHooks(ctx, cmds, func(ctx context.Context) error {
+		return r.execPipelineCmds(ctx, cmds)
+	})
+}
+
+// execPipelineCmds 整个 pipeline 作为熔断器的一次请求
+func (r *Redisgo) execPipelineCmds(ctx context.Context, cmds []*pipeCmd) (err error) {
+	gen, err := r.breaker.allow()
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
+	defer func(begin time.Time) {
+		r.breaker.done(gen, err, time.Since(begin))
+	}(time.Now())
+
+	if r.cluster != nil {
+		return r.clusterExecPipeline(ctx, cmds)
+	}
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		// written 为 true 时命令可能已经部分写入连接，Send 在缓冲区满时也会写入
+		written := false
+		var client redis.Conn
+		if client, err = r.pool.GetContext(ctx); err == nil {
+			written = true
+			err = sendPipeline(ctx, client, cmds)
+			client.Close()
+		}
+		if err == nil {
+			break
+		}
+		err = convertErr(err)
+		if !r.retry.shouldRetryPipeline(ctx, cmds, err, written, attempt, start) || !r.retry.wait(ctx, attempt, start) {
+			break
+		}
+	}
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
+
+	for _, c := range cmds {
+		r.onError(c.err)
+		if err == nil {
+			err = c.err
+		}
+	}
+	return err
+}
+
+// sendPipeline 返回错误时命令没有全部写入连接，已经写入的部分可能已经执行
+// 读取结果时的连接错误设置到之后的每条命令上
+func sendPipeline(ctx context.Context, client redis.Conn, cmds []*pipeCmd) error {
+	for _, c := range cmds {
+		if err := client.Send(c.name, c.args...); err != nil {
+			return err
+		}
+	}
+	if err := client.Flush(); err != nil {
+		return err
+	}
+
+	for i, c := range cmds {
+		reply, err := redis.ReceiveContext(client, ctx)
+		if err != nil {
+			if _, ok := err.(redis.Error); !ok {
+				setCmdsErr(cmds[i:], convertErr(err))
+				return nil
+			}
+		}
+		if c.f != nil {
+			reply, err = c.f(reply, err)
+		}
+		if err == redis.ErrNil {
+			err = nil
+		}
+		c.reply, c.err = reply, err
+	}
+	return nil
+}
+
+// prefixCmds 为队列中命令的 key 加上前缀，任何一条命令无法加前缀时整个队列都不执行
+func (r *Redisgo) prefixCmds(cmds []*pipeCmd) error {
+	for _, c := range cmds {
+		args, f, err := r.prefixCommand(c.name, c.args, c.f)
+		if err != nil {
+			setCmdsErr(cmds, err)
+			return err
+		}
+		c.args, c.f = args, f
+	}
+	return nil
+}
+
+func setCmdsErr(cmds []*pipeCmd, err error) {
+	for _, c := range cmds {
+		c.err = err
+	}
+}
@@ -0,0 +1,241 @@
+package redisgo
+
+import (
+	"context"
+	"github.com/gomodule/redigo/redis"
+	"sync"
+	"time"
+)
+
+const (
+	subHealthCheckInterval = 30 * time.Second
+	subMinBackoff          = 100 * time.Millisecond
+	subMaxBackoff          = 5 * time.Second
+	subChannelSize         = 100
+)
+
+// Message 订阅收到的消息，通过 PSubscribe 订阅时 Pattern 为匹配的模式
+type Message struct {
+	Channel string
+	Pattern string
+	Data    []byte
+}
+
+// Subscriber 使用连接池之外的独立连接订阅频道，连接断开后按退避间隔自动重连并重新订阅
+type Subscriber struct {
+	r        *Redisgo
+	channels []interface{}
+	patterns []interface{}
+	handler  func(Message)
+	ch       chan Message
+	// onReconnect 重连成功后回调，断开期间的消息已经丢失
+	onReconnect func()
+
+	mu     sync.Mutex
+	psc    *redis.PubSubConn
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Subscribe 订阅频道，消息通过 Channel() 返回的 chan 接收，ctx 结束或调用 Close 后 chan 关闭
+func (r *Redisgo) Subscribe(ctx context.Context, channels ...string) (*Subscriber, error) {
+	return r.subscribe(ctx, channels, nil, nil, nil)
+}
+
+// PSubscribe 按模式订阅频道
+func (r *Redisgo) PSubscribe(ctx context.Context, patterns ...string) (*Subscriber, error) {
+	return r.subscribe(ctx, nil, patterns, nil, nil)
+}
+
+// SubscribeFunc 订阅频道，每条消息在接收协程中回调 handler
+func (r *Redisgo) SubscribeFunc(ctx context.Context, handler func(Message), channels ...string) (*Subscriber, error) {
+	return r.subscribe(ctx, channels, nil, handler, nil)
+}
+
+// PSubscribeFunc 按模式订阅频道，每条消息在接收协程中回调 handler
+func (r *Redisgo) PSubscribeFunc(ctx context.Context, handler func(Message), patterns ...string) (*Subscriber, error) {
+	return r.subscribe(ctx, nil, patterns, handler, nil)
+}
+
+// Publish 向频道发送消息，返回收到消息的订阅者数量
+func (r *Redisgo) Publish(ctx context.Context, channel string, message interface{}) (res int, err error) {
+	var reply interface{}
+	reply, err = r.do(ctx, "PUBLISH", redisInt, channel, message)
+	if err != nil {
+		return
+	}
+	res = reply.(int)
+	return
+}
+
+func (r *Redisgo) subscribe(ctx context.Context, channels, patterns []string, handler func(Message), onReconnect func()) (*Subscriber, error) {
+	s := &Subscriber{
+		r:           r,
+		handler:     handler,
+		onReconnect: onReconnect,
+		done:        make(chan struct{}),
+	}
+	for _, c := range channels {
+		s.channels = append(s.channels, c)
+	}
+	for _, p := range patterns {
+		s.patterns = append(s.patterns, p)
+	}
+	if handler == nil {
+		s.ch = make(chan Message, subChannelSize)
+	}
+
+	psc, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.run(ctx, psc)
+	return s, nil
+}
+
+// Channel 接收消息的 chan，使用 SubscribeFunc 订阅时返回 nil
+func (s *Subscriber) Channel() <-chan Message {
+	return s.ch
+}
+
+// Close 取消订阅并关闭连接
+func (s *Subscriber) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+func (s *Subscriber) connect() (*redis.PubSubConn, error) {
+	c, err := s.r.dial()
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	psc := &redis.PubSubConn{Conn: c}
+	if len(s.channels) > 0 {
+		if err := psc.Subscribe(s.channels...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if len(s.patterns) > 0 {
+		if err := psc.PSubscribe(s.patterns...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	// 等待全部订阅确认
+	confirmed := 0
+	for confirmed < len(s.channels)+len(s.patterns) {
+		switch v := psc.ReceiveWithTimeout(subHealthCheckInterval).(type) {
+		case redis.Subscription:
+			confirmed++
+		case error:
+			c.Close()
+			return nil, convertErr(v)
+		}
+	}
+
+	s.mu.Lock()
+	s.psc = psc
+	s.mu.Unlock()
+	return psc, nil
+}
+
+func (s *Subscriber) run(ctx context.Context, psc *redis.PubSubConn) {
+	defer close(s.done)
+	if s.ch != nil {
+		defer close(s.ch)
+	}
+
+	// ctx 结束时关闭连接，使阻塞的 Receive 返回
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		if s.psc != nil {
+			s.psc.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.receive(ctx, psc)
+		psc.Close()
+
+		var err error
+		backoff := subMinBackoff
+		for {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if psc, err = s.connect(); err == nil {
+				break
+			}
+			backoff *= 2
+			if backoff > subMaxBackoff {
+				backoff = subMaxBackoff
+			}
+		}
+
+		// 重连期间 ctx 结束，新连接不会被监听协程关闭
+		if ctx.Err() != nil {
+			psc.Close()
+			return
+		}
+		if s.onReconnect != nil {
+			s.onReconnect()
+		}
+	}
+}
+
+// receive 持续接收消息，直到连接出错
+func (s *Subscriber) receive(ctx context.Context, psc *redis.PubSubConn) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// 定时发送 PING，超过两个周期没有收到任何回复即认为连接已失效
+	go func() {
+		ticker := time.NewTicker(subHealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * subHealthCheckInterval).(type) {
+		case redis.Message:
+			s.deliver(ctx, Message{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data})
+		case error:
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (s *Subscriber) deliver(ctx context.Context, msg Message) {
+	if s.handler != nil {
+		s.handler(msg)
+		return
+	}
+	select {
+	case s.ch <- msg:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,352 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// 单次 BLMOVE 的最长阻塞时间，超过后检查 ctx 是否结束
+	queueMaxBlock = time.Second
+	// 消息的 id 为 uuid 字符串
+	queueIDLen = 36
+)
+
+var (
+	ErrQueueMessage = errors.New("redis: invalid queue message")
+)
+
+// QueueMessage 可靠队列中的消息
+type QueueMessage struct {
+	ID   string
+	Body []byte
+	// raw 保存在 redis 中的内容，Ack 时按原值删除
+	raw string
+}
+
+func parseQueueMessage(raw string) (*QueueMessage, error) {
+	if len(raw) <= queueIDLen || raw[queueIDLen] != ':' {
+		return nil, ErrQueueMessage
+	}
+	return &QueueMessage{ID: raw[:queueIDLen], Body: []byte(raw[queueIDLen+1:]), raw: raw}, nil
+}
+
+// 从队列取出最多 n 条消息放入消费者的处理列表，并记录可见性超时时间
+// KEYS: queue, processing, inflight, consumers  ARGV: n, deadline, consumer
+var queuePopScript = NewScript(4, `
+local res = {}
+for i = 1, tonumber(ARGV[1]) do
+	local v = redis.call('LMOVE', KEYS[1], KEYS[2], 'RIGHT', 'LEFT')
+	if not v then
+		break
+	end
+	redis.call('ZADD', KEYS[3], ARGV[2], v)
+	res[#res + 1] = v
+end
+if #res > 0 then
+	redis.call('SADD', KEYS[4], ARGV[3])
+end
+return res
+`)
+
+// 确认消息，只在消息仍属于当前消费者时删除超时记录
+// KEYS: processing, inflight  ARGV: raw...
+var queueAckScript = NewScript(2, `
+local n = 0
+for _, v in ipairs(ARGV) do
+	local removed = redis.call('LREM', KEYS[1], -1, v)
+	if removed > 0 then
+		redis.call('ZREM', KEYS[2], v)
+		n = n + removed
+	end
+end
+return n
+`)
+
+// 将消息放回队列头部，下一次 Pop 时优先取出
+// KEYS: processing, inflight, queue  ARGV: raw
+var queueNackScript = NewScript(3, `
+if redis.call('LREM', KEYS[1], -1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('RPUSH', KEYS[3], ARGV[1])
+return 1
+`)
+
+// 将消费者处理列表中超时的消息放回队列头部，BLMOVE 之后还没有记录超时时间的消息补充记录
+// KEYS: queue, processing, inflight, consumers  ARGV: now, deadline, consumer
+var queueReapScript = NewScript(4, `
+local items = redis.call('LRANGE', KEYS[2], 0, -1)
+if #items == 0 then
+	redis.call('SREM', KEYS[4], ARGV[3])
+	return 0
+end
+local n = 0
+for _, v in ipairs(items) do
+	local d = redis.call('ZSCORE', KEYS[3], v)
+	if not d then
+		redis.call('ZADD', KEYS[3], ARGV[2], v)
+	elseif tonumber(d) <= tonumber(ARGV[1]) then
+		redis.call('LREM', KEYS[2], 1, v)
+		redis.call('ZREM', KEYS[3], v)
+		redis.call('RPUSH', KEYS[1], v)
+		n = n + 1
+	end
+end
+return n
+`)
+
+type queueOptions struct {
+	visibility   time.Duration
+	reapInterval time.Duration
+}
+
+type QueueOption func(*queueOptions)
+
+// WithQueueVisibilityTimeout 取出后超过该时间没有 Ack 的消息会被重新放回队列
+func WithQueueVisibilityTimeout(d time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.visibility = d
+	}
+}
+
+// WithQueueReapInterval RunReaper 检查超时消息的间隔
+func WithQueueReapInterval(d time.Duration) QueueOption {
+	return func(o *queueOptions) {
+		o.reapInterval = d
+	}
+}
+
+// ReliableQueue 可靠队列，消息取出时原子地移动到消费者自己的处理列表，处理完成后需要 Ack
+// 消费者崩溃或超过可见性超时仍未 Ack 的消息由 RunReaper 放回队列，因此消息至少被处理一次
+// key 使用 {name} 作为 hash tag 以便在集群模式下使用，需要 redis 6.2 以上
+type ReliableQueue struct {
+	r        *Redisgo
+	name     string
+	consumer string
+	opts     queueOptions
+
+	queue      string
+	processing string
+	inflight   string
+	consumers  string
+}
+
+// NewReliableQueue consumer 为消费者名称，同一时间每个名称只应当被一个进程使用
+func NewReliableQueue(r *Redisgo, name, consumer string, opts ...QueueOption) *ReliableQueue {
+	o := queueOptions{
+		visibility:   5 * time.Minute,
+		reapInterval: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	prefix := "queue:{" + name + "}"
+	q := &ReliableQueue{
+		r:         r,
+		name:      name,
+		consumer:  consumer,
+		opts:      o,
+		queue:     prefix,
+		inflight:  prefix + ":inflight",
+		consumers: prefix + ":consumers",
+	}
+	q.processing = q.processingKey(consumer)
+	return q
+}
+
+func (q *ReliableQueue) processingKey(consumer string) string {
+	return q.queue + ":processing:" + consumer
+}
+
+// Push 将消息加入队列尾部，返回消息 id
+func (q *ReliableQueue) Push(ctx context.Context, bodies ...[]byte) ([]string, error) {
+	ids := make([]string, 0, len(bodies))
+	args := make([]interface{}, 0, len(bodies)+1)
+	args = append(args, q.queue)
+	for _, body := range bodies {
+		id := uuid.New().String()
+		ids = append(ids, id)
+		args = append(args, id+":"+string(body))
+	}
+	if _, err := q.r.do(ctx, "LPUSH", nil, args...); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Len 返回队列中等待消费的消息数，读主节点，刚写入的消息立即可见
+func (q *ReliableQueue) Len(ctx context.Context) (int, error) {
+	return redis.Int(q.r.Do(ctx, "LLEN", q.queue))
+}
+
+// Pop 取出一条消息，队列为空时最多等待 block，block 为 0 时一直等待直到 ctx 结束
+// 超时返回 nil, nil，ctx 结束返回 ctx.Err()
+func (q *ReliableQueue) Pop(ctx context.Context, block time.Duration) (*QueueMessage, error) {
+	msgs, err := q.PopBatch(ctx, 1, block)
+	if err != nil || len(msgs) == 0 {
+		return nil, err
+	}
+	return msgs[0], nil
+}
+
+// PopBatch 最多取出 n 条消息，队列为空时等待规则与 Pop 相同
+func (q *ReliableQueue) PopBatch(ctx context.Context, n int, block time.Duration) ([]*QueueMessage, error) {
+	msgs, err := q.tryPop(ctx, n)
+	if err != nil || len(msgs) > 0 {
+		return msgs, err
+	}
+
+	var deadline time.Time
+	if block > 0 {
+		deadline = time.Now().Add(block)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		wait := queueMaxBlock
+		if !deadline.IsZero() {
+			remain := time.Until(deadline)
+			if remain <= 0 {
+				return nil, nil
+			}
+			if remain < wait {
+				wait = remain
+			}
+		}
+
+		msg, err := q.blockingPop(ctx, wait)
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil {
+			continue
+		}
+
+		msgs = append(msgs, msg)
+		if n > 1 {
+			// 队列中已经有消息，剩余的不再阻塞等待
+			more, err := q.tryPop(ctx, n-1)
+			if err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, more...)
+		}
+		return msgs, nil
+	}
+}
+
+func (q *ReliableQueue) tryPop(ctx context.Context, n int) ([]*QueueMessage, error) {
+	deadline := time.Now().Add(q.opts.visibility).UnixMilli()
+	values, err := queuePopScript.Strings(ctx, q.r, q.queue, q.processing, q.inflight, q.consumers, n, deadline, q.consumer)
+	if err != nil {
+		return nil, err
+	}
+	return q.parse(ctx, values), nil
+}
+
+// blockingPop BLMOVE 之后再记录超时时间，两步之间进程退出时由 reaper 补充记录
+func (q *ReliableQueue) blockingPop(ctx context.Context, wait time.Duration) (*QueueMessage, error) {
+	reply, err := q.r.doBlocking(ctx, wait, "BLMOVE", redisString, q.queue, q.processing, "RIGHT", "LEFT", wait.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := reply.(string)
+	if raw == "" {
+		return nil, nil
+	}
+
+	p := q.r.Pipeline(ctx)
+	p.ZAdd(q.inflight, time.Now().Add(q.opts.visibility).UnixMilli(), raw)
+	p.SAdd(q.consumers, q.consumer)
+	if err := p.Exec(); err != nil {
+		return nil, err
+	}
+
+	msgs := q.parse(ctx, []string{raw})
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	return msgs[0], nil
+}
+
+// parse 无法解析的消息不是由 ReliableQueue 写入的，直接从处理列表中删除
+func (q *ReliableQueue) parse(ctx context.Context, values []string) []*QueueMessage {
+	msgs := make([]*QueueMessage, 0, len(values))
+	for _, v := range values {
+		msg, err := parseQueueMessage(v)
+		if err != nil {
+			queueAckScript.Int(ctx, q.r, q.processing, q.inflight, v)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// Ack 确认消息已处理完成，返回确认成功的数量
+// 消息已因超时被放回队列时确认不会成功，消息可能会被再次处理
+func (q *ReliableQueue) Ack(ctx context.Context, msgs ...*QueueMessage) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, 0, len(msgs)+2)
+	args = append(args, q.processing, q.inflight)
+	for _, msg := range msgs {
+		args = append(args, msg.raw)
+	}
+	return queueAckScript.Int(ctx, q.r, args...)
+}
+
+// Nack 放弃处理，将消息放回队列头部
+func (q *ReliableQueue) Nack(ctx context.Context, msg *QueueMessage) error {
+	_, err := queueNackScript.Int(ctx, q.r, q.processing, q.inflight, q.queue, msg.raw)
+	return err
+}
+
+// Extend 将消息的可见性超时延长为从现在起 d 之后
+func (q *ReliableQueue) Extend(ctx context.Context, msg *QueueMessage, d time.Duration) error {
+	_, err := q.r.do(ctx, "ZADD", nil, q.inflight, "XX", time.Now().Add(d).UnixMilli(), msg.raw)
+	return err
+}
+
+// Reap 将所有消费者处理列表中超时的消息放回队列，返回放回的数量
+func (q *ReliableQueue) Reap(ctx context.Context) (int, error) {
+	// 从节点可能还没有同步到新注册的消费者，必须读主节点
+	consumers, err := redis.Strings(q.r.Do(ctx, "SMEMBERS", q.consumers))
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	now := time.Now()
+	deadline := now.Add(q.opts.visibility).UnixMilli()
+	for _, c := range consumers {
+		n, err := queueReapScript.Int(ctx, q.r, q.queue, q.processingKey(c), q.inflight, q.consumers, now.UnixMilli(), deadline, c)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// RunReaper 定时执行 Reap，阻塞直到 ctx 结束，多个进程同时运行不会重复放回消息
+func (q *ReliableQueue) RunReaper(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.Reap(ctx)
+		}
+	}
+}
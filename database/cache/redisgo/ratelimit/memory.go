@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// 进程内实现清理过期状态的间隔
+	memorySweepInterval = time.Minute
+)
+
+type memoryState struct {
+	// TokenBucket: tokens, ts; SlidingWindowCounter: w, c, p; GCRA: ts 为 TAT
+	tokens float64
+	ts     float64
+	w      float64
+	c      float64
+	p      float64
+	// SlidingWindowLog 窗口内每次请求的时间
+	log      []float64
+	expireAt float64
+}
+
+type memoryLimiter struct {
+	algo  Algorithm
+	limit Limit
+	opts  options
+
+	mu        sync.Mutex
+	states    map[string]*memoryState
+	lastSweep float64
+}
+
+// NewMemory 创建进程内的限流器，算法与 New 相同，状态只在当前进程内有效
+func NewMemory(algo Algorithm, limit Limit, opts ...Option) Limiter {
+	return &memoryLimiter{
+		algo:   algo,
+		limit:  limit,
+		opts:   newOptions(opts),
+		states: make(map[string]*memoryState),
+	}
+}
+
+func (l *memoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *memoryLimiter) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	if n < 1 {
+		return Result{}, ErrInvalidN
+	}
+	limit, err := l.opts.limit(key, l.limit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := float64(l.opts.now().UnixMicro())
+	l.sweep(now)
+	s, ok := l.states[key]
+	if !ok || s.expireAt <= now {
+		s = &memoryState{}
+		l.states[key] = s
+	}
+
+	switch l.algo {
+	case TokenBucket:
+		return s.tokenBucket(now, float64(limit.burst()), limit.interval(), float64(n)), nil
+	case SlidingWindowLog:
+		return s.slidingLog(now, limit.Rate, float64(limit.Period.Microseconds()), n), nil
+	case SlidingWindowCounter:
+		return s.slidingCounter(now, float64(limit.Rate), float64(limit.Period.Microseconds()), float64(n)), nil
+	case GCRA:
+		return s.gcra(now, float64(limit.burst()), limit.interval(), float64(n)), nil
+	default:
+		return Result{}, ErrUnknownAlgorithm
+	}
+}
+
+func (l *memoryLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	delete(l.states, key)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *memoryLimiter) sweep(now float64) {
+	if now-l.lastSweep < float64(memorySweepInterval.Microseconds()) {
+		return
+	}
+	l.lastSweep = now
+	for k, s := range l.states {
+		if s.expireAt <= now {
+			delete(l.states, k)
+		}
+	}
+}
+
+// 以下算法与 redis.go 中的 Lua 脚本一一对应，时间单位为微秒
+
+func (s *memoryState) tokenBucket(now, capacity, interval, n float64) Result {
+	if s.expireAt == 0 {
+		s.tokens, s.ts = capacity, now
+	}
+	if now > s.ts {
+		s.tokens = math.Min(capacity, s.tokens+(now-s.ts)/interval)
+		s.ts = now
+	}
+
+	allowed, retry := false, 0.0
+	if n > capacity {
+		retry = -1
+	} else if s.tokens >= n {
+		s.tokens -= n
+		allowed = true
+	} else {
+		retry = math.Ceil((n - s.tokens) * interval)
+	}
+
+	reset := math.Ceil((capacity - s.tokens) * interval)
+	s.expireAt = now + reset + float64(time.Second.Microseconds())
+	return newResult(allowed, int(s.tokens), int64(retry), int64(reset))
+}
+
+func (s *memoryState) slidingLog(now float64, limit int, window float64, n int) Result {
+	i := 0
+	for i < len(s.log) && s.log[i] <= now-window {
+		i++
+	}
+	s.log = s.log[i:]
+	count := len(s.log)
+
+	allowed, retry := false, 0.0
+	if n > limit {
+		retry = -1
+	} else if count+n <= limit {
+		for j := 0; j < n; j++ {
+			s.log = append(s.log, now)
+		}
+		count += n
+		allowed = true
+	} else {
+		retry = math.Ceil(s.log[count+n-limit-1] + window - now)
+	}
+
+	reset := 0.0
+	if len(s.log) > 0 {
+		reset = math.Ceil(s.log[len(s.log)-1] + window - now)
+	}
+	s.expireAt = now + reset
+	return newResult(allowed, limit-count, int64(retry), int64(reset))
+}
+
+func (s *memoryState) slidingCounter(now, limit, window, n float64) Result {
+	w := math.Floor(now / window)
+	if s.expireAt == 0 || s.w != w {
+		if s.expireAt != 0 && s.w == w-1 {
+			s.p = s.c
+		} else {
+			s.p = 0
+		}
+		s.c = 0
+		s.w = w
+	}
+
+	elapsed := now - w*window
+	weighted := s.p*(1-elapsed/window) + s.c
+
+	allowed, retry := false, 0.0
+	if n > limit {
+		retry = -1
+	} else if weighted+n <= limit {
+		s.c += n
+		weighted += n
+		allowed = true
+	} else if s.p > 0 && s.c+n <= limit {
+		retry = math.Ceil((1-(limit-s.c-n)/s.p)*window - elapsed)
+	} else {
+		retry = math.Ceil(window - elapsed + math.Max(0, 1-(limit-n)/s.c)*window)
+	}
+
+	reset := math.Ceil(window - elapsed)
+	if s.c > 0 {
+		reset += window
+	}
+	s.expireAt = now + 2*window
+	return newResult(allowed, int(math.Floor(limit-weighted)), int64(retry), int64(reset))
+}
+
+func (s *memoryState) gcra(now, burst, interval, n float64) Result {
+	tat := s.ts
+	if s.expireAt == 0 || tat < now {
+		tat = now
+	}
+
+	tolerance := burst * interval
+	newTat := tat + n*interval
+	diff := now - (newTat - tolerance)
+
+	if n > burst {
+		return newResult(false, 0, -1, int64(math.Ceil(tat-now)))
+	}
+	if diff < 0 {
+		return newResult(false, int(math.Floor((now-(tat-tolerance))/interval)), int64(math.Ceil(-diff)), int64(math.Ceil(tat-now)))
+	}
+
+	s.ts = newTat
+	s.expireAt = newTat
+	return newResult(true, int(math.Floor(diff/interval)), 0, int64(math.Ceil(newTat-now)))
+}
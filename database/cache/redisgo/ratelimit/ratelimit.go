@@ -0,0 +1,169 @@
+// Package ratelimit 基于 Redisgo 的分布式限流，算法通过 Lua 脚本原子执行
+// 同时提供接口相同的进程内实现，便于测试和单机使用
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidLimit     = errors.New("ratelimit: invalid limit")
+	ErrUnknownAlgorithm = errors.New("ratelimit: unknown algorithm")
+	ErrInvalidN         = errors.New("ratelimit: n must be at least 1")
+
+	errUnexpectedReply = errors.New("ratelimit: unexpected script reply")
+)
+
+// Algorithm 限流算法
+type Algorithm int
+
+const (
+	// TokenBucket 令牌桶，以 Rate/Period 的速度补充令牌，最多积累 Burst 个
+	TokenBucket Algorithm = iota
+	// SlidingWindowLog 滑动窗口日志，精确记录窗口内每次请求的时间，内存占用与 Rate 成正比
+	SlidingWindowLog
+	// SlidingWindowCounter 滑动窗口计数，按前一个固定窗口的剩余比例加权估算，内存占用固定
+	SlidingWindowCounter
+	// GCRA 通用信元速率算法，效果与令牌桶相同，只需要保存一个时间戳
+	GCRA
+)
+
+// Limit 每个 Period 允许 Rate 次请求
+// Burst 为令牌桶和 GCRA 允许的突发请求数，为 0 时等于 Rate，滑动窗口算法忽略 Burst
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+func PerHour(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Hour}
+}
+
+func (l Limit) IsZero() bool {
+	return l == Limit{}
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// interval 补充一个令牌的时间，单位微秒
+func (l Limit) interval() float64 {
+	return float64(l.Period.Microseconds()) / float64(l.Rate)
+}
+
+func (l Limit) valid() bool {
+	return l.Rate > 0 && l.Period >= time.Millisecond
+}
+
+// Result 限流结果
+type Result struct {
+	Allowed bool
+	// Remaining 本次请求之后还可以立即通过的请求数
+	Remaining int
+	// RetryAfter 被拒绝时需要等待的时间，允许时为 0，为 -1 时表示请求数超过了容量，永远不会通过
+	RetryAfter time.Duration
+	// ResetAfter 恢复到完全没有请求的状态需要的时间
+	ResetAfter time.Duration
+}
+
+// Limiter Redis 和进程内实现共用的接口
+type Limiter interface {
+	// Allow 等同于 AllowN(ctx, key, 1)
+	Allow(ctx context.Context, key string) (Result, error)
+	// AllowN 尝试获取 n 次请求的配额，拒绝时不消耗配额，n 小于 1 时返回 ErrInvalidN
+	AllowN(ctx context.Context, key string, n int) (Result, error)
+	// Reset 清除 key 的限流状态
+	Reset(ctx context.Context, key string) error
+}
+
+type options struct {
+	prefix    string
+	limitFunc func(key string) Limit
+	now       func() time.Time
+}
+
+type Option func(*options)
+
+// WithPrefix 保存限流状态的 key 前缀，默认为 "ratelimit:"
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithLimitFunc 按 key 指定限流配置，返回零值时使用创建时的默认配置
+func WithLimitFunc(fn func(key string) Limit) Option {
+	return func(o *options) {
+		o.limitFunc = fn
+	}
+}
+
+// WithKeyLimits 为指定的 key 设置限流配置，其他 key 使用默认配置
+func WithKeyLimits(limits map[string]Limit) Option {
+	return WithLimitFunc(func(key string) Limit {
+		return limits[key]
+	})
+}
+
+// WithClock 进程内实现使用的时钟，Redis 实现始终使用服务端时间
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		prefix: "ratelimit:",
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o *options) limit(key string, def Limit) (Limit, error) {
+	l := def
+	if o.limitFunc != nil {
+		if kl := o.limitFunc(key); !kl.IsZero() {
+			l = kl
+		}
+	}
+	if !l.valid() {
+		return l, ErrInvalidLimit
+	}
+	return l, nil
+}
+
+// newResult 将微秒为单位的结果转换为 Result
+func newResult(allowed bool, remaining int, retryAfter, resetAfter int64) Result {
+	res := Result{
+		Allowed:    allowed,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(retryAfter) * time.Microsecond,
+		ResetAfter: time.Duration(resetAfter) * time.Microsecond,
+	}
+	if retryAfter < 0 {
+		res.RetryAfter = -1
+	}
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return res
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+)
+
+type step struct {
+	// advance 执行前经过的时间
+	advance time.Duration
+	n       int
+	want    Result
+}
+
+// 用例从窗口开始后 100ms 执行，Period 均为 1s
+var cases = []struct {
+	name  string
+	algo  Algorithm
+	limit Limit
+	steps []step
+}{
+	{"TokenBucket", TokenBucket, PerSecond(4), []step{
+		{0, 1, Result{true, 3, 0, 250 * time.Millisecond}},
+		{0, 3, Result{true, 0, 0, time.Second}},
+		{0, 1, Result{false, 0, 250 * time.Millisecond, time.Second}},
+		// 超过容量永远不会通过
+		{0, 5, Result{false, 0, -1, time.Second}},
+		// 500ms 补充两个令牌
+		{500 * time.Millisecond, 1, Result{true, 1, 0, 750 * time.Millisecond}},
+	}},
+	{"SlidingWindowLog", SlidingWindowLog, PerSecond(3), []step{
+		{0, 2, Result{true, 1, 0, time.Second}},
+		{400 * time.Millisecond, 1, Result{true, 0, 0, time.Second}},
+		// 最早的两条记录在 600ms 后移出窗口
+		{0, 1, Result{false, 0, 600 * time.Millisecond, time.Second}},
+		{0, 4, Result{false, 0, -1, time.Second}},
+		{700 * time.Millisecond, 2, Result{true, 0, 0, time.Second}},
+	}},
+	{"SlidingWindowCounter", SlidingWindowCounter, PerSecond(4), []step{
+		{0, 3, Result{true, 1, 0, 1900 * time.Millisecond}},
+		// 下一个窗口中当前窗口的权重降到 2/3 时才能通过
+		{0, 2, Result{false, 1, 1233334 * time.Microsecond, 1900 * time.Millisecond}},
+		{0, 5, Result{false, 1, -1, 1900 * time.Millisecond}},
+		// 进入下一个窗口，前一个窗口的 3 次按 90% 计算
+		{time.Second, 1, Result{true, 0, 0, 1900 * time.Millisecond}},
+		{0, 1, Result{false, 0, 233334 * time.Microsecond, 1900 * time.Millisecond}},
+		// 跳过一个窗口后前一个窗口的计数不再计算
+		{2 * time.Second, 4, Result{true, 0, 0, 1900 * time.Millisecond}},
+	}},
+	{"GCRA", GCRA, PerSecond(2), []step{
+		{0, 1, Result{true, 1, 0, 500 * time.Millisecond}},
+		{0, 1, Result{true, 0, 0, time.Second}},
+		{0, 1, Result{false, 0, 500 * time.Millisecond, time.Second}},
+		{0, 3, Result{false, 0, -1, time.Second}},
+		{600 * time.Millisecond, 1, Result{true, 0, 0, 900 * time.Millisecond}},
+	}},
+}
+
+// runCases newLimiter 返回限流器和让时间经过的函数，tolerance 为时间类结果允许的误差
+func runCases(t *testing.T, newLimiter func(algo Algorithm, limit Limit) (Limiter, func(d time.Duration)), tolerance time.Duration) {
+	ctx := context.Background()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, advance := newLimiter(tc.algo, tc.limit)
+			key := tc.name + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+			defer l.Reset(ctx, key)
+
+			for _, n := range []int{0, -1} {
+				if _, err := l.AllowN(ctx, key, n); err != ErrInvalidN {
+					t.Errorf("n=%d: got %v, want ErrInvalidN", n, err)
+				}
+			}
+			for i, s := range tc.steps {
+				advance(s.advance)
+				got, err := l.AllowN(ctx, key, s.n)
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if got.Allowed != s.want.Allowed || got.Remaining != s.want.Remaining ||
+					!near(got.RetryAfter, s.want.RetryAfter, tolerance) || !near(got.ResetAfter, s.want.ResetAfter, tolerance) {
+					t.Errorf("step %d: got %+v, want %+v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func near(got, want, tolerance time.Duration) bool {
+	if want < 0 {
+		return got == want
+	}
+	d := got - want
+	return d >= -tolerance && d <= tolerance
+}
+
+func TestMemory(t *testing.T) {
+	runCases(t, func(algo Algorithm, limit Limit) (Limiter, func(d time.Duration)) {
+		now := time.Unix(1700000000, 0).Add(100 * time.Millisecond)
+		l := NewMemory(algo, limit, WithClock(func() time.Time { return now }))
+		return l, func(d time.Duration) { now = now.Add(d) }
+	}, 0)
+}
+
+func TestMemoryLimits(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemory(TokenBucket, PerSecond(1), WithKeyLimits(map[string]Limit{
+		"big":     PerSecond(10),
+		"invalid": {Rate: 1, Period: time.Microsecond},
+	}))
+	if res, err := l.AllowN(ctx, "big", 10); err != nil || !res.Allowed {
+		t.Errorf("key limit: got %+v, %v", res, err)
+	}
+	if res, err := l.AllowN(ctx, "other", 2); err != nil || res.RetryAfter != -1 {
+		t.Errorf("default limit: got %+v, %v", res, err)
+	}
+	if _, err := l.Allow(ctx, "invalid"); err != ErrInvalidLimit {
+		t.Errorf("invalid limit: got %v", err)
+	}
+}
+
+// TestRedis 设置 REDISGO_TEST_ADDR 时对 New 执行相同的用例，确认 memory.go 与 Lua 脚本的结果一致
+// Redis 使用服务端时间，通过 sleep 经过时间，先等到服务端时间的整秒后 100ms 再开始
+func TestRedis(t *testing.T) {
+	addr := os.Getenv("REDISGO_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDISGO_TEST_ADDR not set")
+	}
+	r := redisgo.NewRedisgo(redisgo.WithAddr(addr))
+	defer r.Close()
+
+	runCases(t, func(algo Algorithm, limit Limit) (Limiter, func(d time.Duration)) {
+		values, err := redis.Int64s(r.DoCtx(context.Background(), "TIME"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		micros := values[1]
+		time.Sleep(time.Second - time.Duration(micros)*time.Microsecond + 100*time.Millisecond)
+		return New(r, algo, limit, WithPrefix("redisgo:test:ratelimit:")), time.Sleep
+	}, 50*time.Millisecond)
+}
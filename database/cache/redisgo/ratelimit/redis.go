@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/google/uuid"
+)
+
+// 所有脚本使用服务端时间，单位微秒，返回 {allowed, remaining, retry_after, reset_after}
+// redis.replicate_commands 使脚本中调用 TIME 后仍可以写入，redis 5.0 之后为默认行为
+const luaNow = `
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+`
+
+// ARGV: capacity, interval, n
+var tokenBucketScript = redisgo.NewScript(1, luaNow+`
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) / interval)
+	ts = now
+end
+
+local allowed = 0
+local retry = 0
+if n > capacity then
+	retry = -1
+elseif tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) * interval)
+end
+
+local reset = math.ceil((capacity - tokens) * interval)
+redis.call('HMSET', KEYS[1], 'tokens', tokens, 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil(reset / 1000) + 1000)
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// ARGV: limit, window, n, member
+var slidingLogScript = redisgo.NewScript(1, luaNow+`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+local retry = 0
+if n > limit then
+	retry = -1
+elseif count + n <= limit then
+	for i = 1, n do
+		redis.call('ZADD', KEYS[1], now, t[1] .. '.' .. t[2] .. ':' .. ARGV[4] .. ':' .. i)
+	end
+	count = count + n
+	allowed = 1
+	redis.call('PEXPIRE', KEYS[1], math.ceil(window / 1000))
+else
+	-- 等到最早的若干条记录移出窗口后才有足够的配额
+	local idx = count + n - limit - 1
+	local oldest = redis.call('ZRANGE', KEYS[1], idx, idx, 'WITHSCORES')
+	retry = math.ceil(tonumber(oldest[2]) + window - now)
+end
+
+local reset = 0
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if #newest == 2 then
+	reset = math.ceil(tonumber(newest[2]) + window - now)
+end
+return {allowed, limit - count, retry, reset}
+`)
+
+// ARGV: limit, window, n
+var slidingCounterScript = redisgo.NewScript(1, luaNow+`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local w = math.floor(now / window)
+local state = redis.call('HMGET', KEYS[1], 'w', 'c', 'p')
+local sw = tonumber(state[1])
+local c = tonumber(state[2]) or 0
+local p = tonumber(state[3]) or 0
+if sw ~= w then
+	if sw == w - 1 then
+		p = c
+	else
+		p = 0
+	end
+	c = 0
+end
+
+local elapsed = now - w * window
+local weighted = p * (1 - elapsed / window) + c
+
+local allowed = 0
+local retry = 0
+if n > limit then
+	retry = -1
+elseif weighted + n <= limit then
+	c = c + n
+	weighted = weighted + n
+	allowed = 1
+elseif p > 0 and c + n <= limit then
+	-- 等到前一个窗口的权重降低到足够小
+	retry = math.ceil((1 - (limit - c - n) / p) * window - elapsed)
+else
+	-- 等到下一个窗口中当前窗口的权重降低到足够小
+	retry = math.ceil(window - elapsed + math.max(0, 1 - (limit - n) / c) * window)
+end
+
+redis.call('HMSET', KEYS[1], 'w', w, 'c', c, 'p', p)
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * window / 1000))
+local reset = math.ceil(window - elapsed)
+if c > 0 then
+	reset = reset + window
+end
+return {allowed, math.floor(limit - weighted), retry, reset}
+`)
+
+// ARGV: burst, interval, n
+var gcraScript = redisgo.NewScript(1, luaNow+`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local tolerance = burst * interval
+local newTat = tat + n * interval
+local diff = now - (newTat - tolerance)
+
+if n > burst then
+	return {0, 0, -1, math.ceil(tat - now)}
+end
+if diff < 0 then
+	return {0, math.floor((now - (tat - tolerance)) / interval), math.ceil(-diff), math.ceil(tat - now)}
+end
+
+redis.call('SET', KEYS[1], newTat, 'PX', math.ceil((newTat - now) / 1000))
+return {1, math.floor(diff / interval), 0, math.ceil(newTat - now)}
+`)
+
+type redisLimiter struct {
+	r     *redisgo.Redisgo
+	algo  Algorithm
+	limit Limit
+	opts  options
+}
+
+// New 创建基于 Redis 的限流器，limit 为默认的限流配置
+func New(r *redisgo.Redisgo, algo Algorithm, limit Limit, opts ...Option) Limiter {
+	return &redisLimiter{r: r, algo: algo, limit: limit, opts: newOptions(opts)}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *redisLimiter) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	if n < 1 {
+		return Result{}, ErrInvalidN
+	}
+	limit, err := l.opts.limit(key, l.limit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var (
+		values []int
+		rkey   = l.opts.prefix + key
+	)
+	switch l.algo {
+	case TokenBucket:
+		values, err = tokenBucketScript.Ints(ctx, l.r, rkey, limit.burst(), limit.interval(), n)
+	case SlidingWindowLog:
+		values, err = slidingLogScript.Ints(ctx, l.r, rkey, limit.Rate, limit.Period.Microseconds(), n, uuid.New().String())
+	case SlidingWindowCounter:
+		values, err = slidingCounterScript.Ints(ctx, l.r, rkey, limit.Rate, limit.Period.Microseconds(), n)
+	case GCRA:
+		values, err = gcraScript.Ints(ctx, l.r, rkey, limit.burst(), limit.interval(), n)
+	default:
+		return Result{}, ErrUnknownAlgorithm
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 4 {
+		return Result{}, errUnexpectedReply
+	}
+	return newResult(values[0] == 1, values[1], int64(values[2]), int64(values[3])), nil
+}
+
+func (l *redisLimiter) Reset(ctx context.Context, key string) error {
+	_, err := l.r.Del(ctx, l.opts.prefix+key)
+	return err
+}
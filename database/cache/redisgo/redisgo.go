@@ -2,8 +2,11 @@ package redisgo
 
 import (
 	"context"
+	"crypto/tls"
 	"github.com/gomodule/redigo/redis"
-	"math/rand"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	"strings"
 	"time"
 )
@@ -16,11 +19,14 @@ type Option func(*option)
 
 type RedisConfig struct {
 	//以下均来自redisgo原生配置
-	// 内部重试次数
+	// 内部重试次数，使用 DefaultRetryPolicy 的退避时间，设置了 RetryPolicy 时忽略
 	Retry int `json:"retry"`
 	// Redis服务器的host和port "localhost:6379"
 	Addr string `json:"addr"`
 
+	// ACL 用户名，为空时使用 default 用户
+	Username string `json:"username"`
+
 	// 连接到redis服务器的密码
 	Password string `json:"password"`
 
@@ -39,6 +45,59 @@ type RedisConfig struct {
 	WriteTimeout   int `json:"write_timeout"`
 
 	Database int `json:"database"`
+
+	// 所有命令中的 key 自动加上的前缀，如 "order:"，用于多个服务共用一个库时隔离 key
+	KeyPrefix string `json:"key_prefix"`
+
+	// 事务因 WATCH 的 key 被修改而失败时的重试次数
+	TxRetry int `json:"tx_retry"`
+
+	// 新建连接时加载所有通过 NewScript 注册的脚本
+	PreloadScripts bool `json:"preload_scripts"`
+
+	// 哨兵模式，设置 SentinelAddrs 后忽略 Addr，通过哨兵获取 MasterName 对应的主节点
+	SentinelAddrs    []string `json:"sentinel_addrs"`
+	MasterName       string   `json:"master_name"`
+	SentinelPassword string   `json:"sentinel_password"`
+
+	// 集群模式，设置 ClusterAddrs 后忽略 Addr 和 Database，通过 CLUSTER SLOTS 获取所有节点
+	ClusterAddrs []string `json:"cluster_addrs"`
+
+	// 从节点地址，读命令按 ReadPolicy 路由到从节点，写命令和 Do 始终在主节点执行
+	ReplicaAddrs []string `json:"replica_addrs"`
+	// 读命令路由策略 master/prefer_replica/round_robin/lowest_latency，默认 master
+	ReadPolicy string `json:"read_policy"`
+	// 从节点健康检查间隔 单位：秒
+	ReplicaCheckInterval int `json:"replica_check_interval"`
+
+	// 使用 TLS 连接，Addr 以 rediss:// 开头时自动开启
+	TLS bool `json:"tls"`
+	// 校验服务端证书的 CA 文件，为空时使用系统证书
+	TLSCAFile string `json:"tls_ca_file"`
+	// 双向认证的客户端证书和私钥
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+	// 校验证书时使用的服务端名称，默认为连接的 host
+	TLSServerName         string `json:"tls_server_name"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify"`
+	// 直接指定 TLS 配置，设置后忽略以上 TLS 文件配置
+	TLSConfig *tls.Config `json:"-"`
+
+	// GetT、SetT 等泛型函数使用的序列化方式，默认为 JSON
+	Codec Codec `json:"-"`
+
+	// 命令执行前后调用的 Hook，按顺序执行
+	Hooks []Hook `json:"-"`
+
+	// 重试策略，为 nil 时使用 DefaultRetryPolicy(Retry)
+	RetryPolicy *RetryPolicy `json:"-"`
+
+	// 熔断配置，为 nil 时不熔断，熔断打开时命令直接返回 ErrCircuitOpen
+	CircuitBreaker *CircuitBreaker `json:"-"`
+
+	// 创建 span 和指标使用的 provider，默认为 otel 的全局 provider
+	TracerProvider trace.TracerProvider `json:"-"`
+	MeterProvider  metric.MeterProvider `json:"-"`
 }
 
 func WithAddr(addr string) Option {
@@ -47,6 +106,12 @@ func WithAddr(addr string) Option {
 	}
 }
 
+func WithUsername(username string) Option {
+	return func(o *option) {
+		o.Username = username
+	}
+}
+
 func WithPassword(ps string) Option {
 	return func(o *option) {
 		o.Password = ps
@@ -95,19 +160,140 @@ func WithDatabase(database int) Option {
 	}
 }
 
+func WithKeyPrefix(prefix string) Option {
+	return func(o *option) {
+		o.KeyPrefix = prefix
+	}
+}
+
+func WithTxRetry(txRetry int) Option {
+	return func(o *option) {
+		o.TxRetry = txRetry
+	}
+}
+
+func WithPreloadScripts(preload bool) Option {
+	return func(o *option) {
+		o.PreloadScripts = preload
+	}
+}
+
+func WithSentinel(masterName string, addrs ...string) Option {
+	return func(o *option) {
+		o.MasterName = masterName
+		o.SentinelAddrs = addrs
+	}
+}
+
+func WithSentinelPassword(ps string) Option {
+	return func(o *option) {
+		o.SentinelPassword = ps
+	}
+}
+
+// WithCluster 使用集群模式，addrs 为任意几个集群节点，Redisgo 的所有命令按 key 所在的 slot 路由
+func WithCluster(addrs ...string) Option {
+	return func(o *option) {
+		o.ClusterAddrs = addrs
+	}
+}
+
+// WithReplicas 设置从节点和读命令的路由策略
+func WithReplicas(policy string, addrs ...string) Option {
+	return func(o *option) {
+		o.ReadPolicy = policy
+		o.ReplicaAddrs = addrs
+	}
+}
+
+func WithReplicaCheckInterval(sec int) Option {
+	return func(o *option) {
+		o.ReplicaCheckInterval = sec
+	}
+}
+
+// WithTLS 使用 TLS 连接，caFile 为空时使用系统证书
+func WithTLS(caFile, serverName string, insecureSkipVerify bool) Option {
+	return func(o *option) {
+		o.TLS = true
+		o.TLSCAFile = caFile
+		o.TLSServerName = serverName
+		o.TLSInsecureSkipVerify = insecureSkipVerify
+	}
+}
+
+// WithTLSClientCert 双向认证时使用的客户端证书
+func WithTLSClientCert(certFile, keyFile string) Option {
+	return func(o *option) {
+		o.TLS = true
+		o.TLSCertFile = certFile
+		o.TLSKeyFile = keyFile
+	}
+}
+
+func WithTLSConfig(c *tls.Config) Option {
+	return func(o *option) {
+		o.TLS = true
+		o.TLSConfig = c
+	}
+}
+
+func WithCodec(c Codec) Option {
+	return func(o *option) {
+		o.Codec = c
+	}
+}
+
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *option) {
+		o.RetryPolicy = &p
+	}
+}
+
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(o *option) {
+		o.CircuitBreaker = &cb
+	}
+}
+
+func WithHooks(hooks ...Hook) Option {
+	return func(o *option) {
+		o.Hooks = append(o.Hooks, hooks...)
+	}
+}
+
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *option) {
+		o.TracerProvider = tp
+	}
+}
+
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *option) {
+		o.MeterProvider = mp
+	}
+}
+
+func defaultConfig() RedisConfig {
+	return RedisConfig{
+		Addr:           "127.0.0.1:6379",
+		MaxIdle:        100,
+		MaxActive:      100,
+		IdleTimeout:    20,
+		ConnectTimeout: 300, //单位为毫秒
+		ReadTimeout:    50,
+		WriteTimeout:   50,
+		Database:       0,
+		Retry:          0,
+		TxRetry:        3,
+
+		ReplicaCheckInterval: 5,
+	}
+}
+
 func NewRedisgo(opts ...Option) *Redisgo {
 	defaultOpt := &option{
-		RedisConfig: RedisConfig{
-			Addr:           "127.0.0.1:6379",
-			MaxIdle:        100,
-			MaxActive:      100,
-			IdleTimeout:    20,
-			ConnectTimeout: 300, //单位为毫秒
-			ReadTimeout:    50,
-			WriteTimeout:   50,
-			Database:       0,
-			Retry:          0,
-		},
+		RedisConfig: defaultConfig(),
 	}
 	for _, o := range opts {
 		o(defaultOpt)
@@ -125,44 +311,102 @@ func newRedis(o *RedisConfig) *Redisgo {
 	opts = append(opts, redis.DialConnectTimeout(time.Duration(o.ConnectTimeout)*time.Millisecond))
 	opts = append(opts, redis.DialReadTimeout(time.Duration(o.ReadTimeout)*time.Millisecond))
 	opts = append(opts, redis.DialWriteTimeout(time.Duration(o.WriteTimeout)*time.Millisecond))
+	if len(o.Username) != 0 {
+		opts = append(opts, redis.DialUsername(o.Username))
+	}
 	if len(o.Password) != 0 {
 		opts = append(opts, redis.DialPassword(o.Password))
 	}
-	opts = append(opts, redis.DialDatabase(o.Database))
-	pool := redisinit(o.Addr, o.Password, o.MaxIdle, o.IdleTimeout, o.MaxActive, opts...)
+	opts = append(opts, tlsDialOptions(o)...)
 	oo := *o
+	r := &Redisgo{
+		opts:    &oo,
+		retry:   newRetryPolicy(&oo),
+		breaker: newCircuitBreaker(oo.CircuitBreaker),
+		prefix:  oo.KeyPrefix,
+		loads:   &singleflight.Group{},
+		blocking: &blockingConns{
+			idle: make(map[string][]*blockingConn),
+			max:  oo.MaxIdle,
+		},
+	}
+	r.commands = commands{r}
+	r.telemetry = newTelemetry(&oo)
+
+	if len(o.ClusterAddrs) > 0 {
+		// 集群只支持 0 号库
+		r.cluster = newCluster(o.ClusterAddrs, func(addr string) *redis.Pool {
+			pool := redisinit(addr, o.MaxIdle, o.IdleTimeout, o.MaxActive, opts...)
+			withPreloadScripts(pool, o.PreloadScripts)
+			return pool
+		})
+		r.telemetry.registerPoolMetrics(r)
+		return r
+	}
+
+	opts = append(opts, redis.DialDatabase(o.Database))
+	r.pool = redisinit(o.Addr, o.MaxIdle, o.IdleTimeout, o.MaxActive, opts...)
+	if len(o.SentinelAddrs) > 0 {
+		r.sentinel = newSentinel(o)
+		r.pool.Dial = r.sentinel.dial(opts...)
+		r.pool.TestOnBorrow = r.sentinel.testOnBorrow(r.pool.TestOnBorrow)
+	}
+	withPreloadScripts(r.pool, o.PreloadScripts)
 
-	return &Redisgo{
-		pool:     pool,
-		opts:     &oo,
-		lastTime: time.Now().UnixNano(),
+	if len(o.ReplicaAddrs) > 0 && o.ReadPolicy != "" && o.ReadPolicy != ReadMasterOnly {
+		interval := time.Duration(o.ReplicaCheckInterval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		r.replicas = newReplicas(o.ReadPolicy, interval, r.pool, o.ReplicaAddrs, func(addr string) *redis.Pool {
+			pool := redisinit(addr, o.MaxIdle, o.IdleTimeout, o.MaxActive, opts...)
+			withPreloadScripts(pool, o.PreloadScripts)
+			return pool
+		})
 	}
+	r.telemetry.registerPoolMetrics(r)
+	return r
 }
 
-func redisinit(server, password string, maxIdle, idleTimeout, maxActive int, options ...redis.DialOption) *redis.Pool {
+func withPreloadScripts(pool *redis.Pool, preload bool) {
+	if !preload {
+		return
+	}
+	dial := pool.Dial
+	pool.Dial = func() (redis.Conn, error) {
+		c, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		if err := preloadScripts(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// redisinit 创建连接池，用户名和密码通过 DialUsername/DialPassword 在建立连接时认证
+func redisinit(server string, maxIdle, idleTimeout, maxActive int, options ...redis.DialOption) *redis.Pool {
 	return &redis.Pool{
 		MaxIdle:     maxIdle,
 		IdleTimeout: time.Duration(idleTimeout) * time.Second,
 		MaxActive:   maxActive,
 		Dial: func() (redis.Conn, error) {
-			var c redis.Conn
-			var err error
 			protocol := "tcp"
-			if strings.HasPrefix(server, "unix://") {
-				server = strings.TrimLeft(server, "unix://")
+			addr := server
+			opts := options
+			switch {
+			case strings.HasPrefix(addr, "unix://"):
+				addr = strings.TrimPrefix(addr, "unix://")
 				protocol = "unix"
+			case strings.HasPrefix(addr, "rediss://"):
+				addr = strings.TrimPrefix(addr, "rediss://")
+				opts = append(opts[:len(opts):len(opts)], redis.DialUseTLS(true))
+			case strings.HasPrefix(addr, "redis://"):
+				addr = strings.TrimPrefix(addr, "redis://")
 			}
-			c, err = redis.Dial(protocol, server, options...)
-			if err != nil {
-				return nil, err
-			}
-			if password != "" {
-				if _, err := c.Do("AUTH", password); err != nil {
-					c.Close()
-					return nil, err
-				}
-			}
-			return c, err
+			return redis.Dial(protocol, addr, opts...)
 		},
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
 			if time.Since(t) < time.Minute {
@@ -175,65 +419,156 @@ func redisinit(server, password string, maxIdle, idleTimeout, maxActive int, opt
 }
 
 // Do 函数为通用的函数， 可以执行任何redis服务器支持的命令 如果涉及到没有封装的命令 可以用此命令调用原始命令
+// 配置了从节点时 Do 也始终在主节点执行
 func (r *Redisgo) Do(ctx context.Context, cmd string, args ...interface{}) (reply interface{}, err error) {
-	return r.do(ctx, cmd, nil, args...)
-}
-
-func (r *Redisgo) randomDuration(n int64) time.Duration {
-	s := rand.NewSource(r.lastTime)
-	return time.Duration(rand.New(s).Int63n(n) + 1)
+	return r.process(ctx, false, cmd, nil, args...)
 }
 
+// do 供封装好的命令使用，只读命令可以路由到从节点
 func (r *Redisgo) do(ctx context.Context, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
-	var (
-		count = 0
-	)
+	return r.process(ctx, isReadCommand(cmd), cmd, f, args...)
+}
 
-retry1:
-	client, err := r.pool.GetContext(ctx)
-	if err != nil {
+func (r *Redisgo) process(ctx context.Context, readOnly bool, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
+	if args, f, err = r.prefixCommand(cmd, args, f); err != nil {
 		return nil, err
 	}
-	defer client.Close()
+	ctx, span := r.telemetry.start(ctx, cmd, args)
+	defer func(start time.Time) {
+		r.telemetry.end(ctx, span, strings.ToUpper(cmd), start, err)
+	}(time.Now())
+
+	return r.processHooks(ctx, cmd, args, func(ctx context.Context, cmd string, args []interface{}) (interface{}, error) {
+		return r.processCmd(ctx, readOnly, cmd, f, args...)
+	})
+}
 
-	reply, err = client.Do(cmd, args...)
+// processCmd 执行命令，失败时按 RetryPolicy 重试
+func (r *Redisgo) processCmd(ctx context.Context, readOnly bool, cmd string, f func(interface{}, error) (interface{}, error), args ...interface{}) (reply interface{}, err error) {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		var gen uint64
+		if gen, err = r.breaker.allow(); err != nil {
+			return nil, err
+		}
+		begin := time.Now()
+		reply, err = r.exec(ctx, readOnly, cmd, args...)
+		r.breaker.done(gen, err, time.Since(begin))
+
+		if f != nil {
+			reply, err = f(reply, err)
+		}
 
-	if f != nil {
-		reply, err = f(reply, err)
+		if err == redis.ErrNil {
+			err = nil
+		}
+		if err == nil {
+			return
+		}
+
+		r.onError(err)
+
+		if !r.retry.shouldRetry(ctx, cmd, args, err, attempt, start) || !r.retry.wait(ctx, attempt, start) {
+			break
+		}
 	}
 
-	if err == redis.ErrNil {
-		err = nil
+	// 服务端返回的错误原样返回，连接错误转换为包内定义的错误
+	if _, ok := err.(redis.Error); ok {
+		return
 	}
+	return nil, convertErr(err)
+}
 
-	// if err is not redis.Error, it will retry
-	if _, ok := err.(redis.Error); err != nil && !ok {
-		var rterr error
-		switch err {
-		case redis.ErrPoolExhausted:
-			rterr = ErrConnExhausted
-		default:
-			if strings.Contains(err.Error(), "timeout") {
-				rterr = ErrTimeout
-			} else {
-				rterr = err
-			}
-		}
+// onError 服务端返回 READONLY 时说明哨兵模式下连接的主节点已经降级，通知哨兵重新查询主节点
+// 单条命令、pipeline 和事务返回的错误都需要经过这里
+func (r *Redisgo) onError(err error) {
+	if r.sentinel != nil && err != nil {
+		r.sentinel.onError(err)
+	}
+}
 
-		if r.opts.Retry > 0 && count < r.opts.Retry {
-			count++
-			time.Sleep(time.Millisecond * r.randomDuration(10))
-			goto retry1
+// exec 在单机、哨兵或集群对应的节点上执行一次命令，readOnly 为 true 时可以在从节点执行
+func (r *Redisgo) exec(ctx context.Context, readOnly bool, cmd string, args ...interface{}) (interface{}, error) {
+	if r.cluster != nil {
+		return r.cluster.do(ctx, cmd, args)
+	}
+	if readOnly && r.replicas != nil {
+		if reply, ok, err := r.execReplica(ctx, cmd, args...); ok {
+			return reply, err
 		}
+	}
+
+	client, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
 
-		return nil, rterr
+	setPeer(ctx, r.masterAddr())
+	return doContext(ctx, client, cmd, args...)
+}
+
+// doContext 在连接上执行一次命令，ctx 的截止时间早于 ReadTimeout 时作为本次调用的读超时
+// ctx 取消或到期时关闭连接使读写立即返回，出错的连接不会放回连接池
+func doContext(ctx context.Context, c redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	if ctx.Done() == nil {
+		return c.Do(cmd, args...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	return redis.DoContext(c, ctx, cmd, args...)
+}
 
-	return
+// conn 返回一个连接池中的连接，集群模式下为 key 所在节点的连接
+func (r *Redisgo) conn(ctx context.Context, key string) (redis.Conn, error) {
+	if r.cluster != nil {
+		return r.cluster.conn(ctx, key)
+	}
+	return r.pool.GetContext(ctx)
+}
+
+// dial 新建一个不属于连接池的连接
+func (r *Redisgo) dial() (redis.Conn, error) {
+	if r.cluster != nil {
+		return r.cluster.dial()
+	}
+	return r.pool.Dial()
 }
 
 type Redisgo struct {
+	commands
 	pool     *redis.Pool
 	opts     *RedisConfig
-	lastTime int64
+	sentinel *sentinel
+	cluster  *cluster
+	replicas *replicas
+	// blocking 阻塞命令使用的连接，与 Namespace 创建的客户端共用
+	blocking *blockingConns
+	retry    *RetryPolicy
+	breaker  *circuitBreaker
+	// prefix 为 KeyPrefix 加上 Namespace 的名称
+	prefix string
+	// namespace 为 true 时为 Namespace 创建的客户端，与父客户端共用连接池
+	namespace bool
+	// loads GetOrLoad 的并发加载合并，与 Namespace 创建的客户端共用，key 中包含前缀
+	loads *singleflight.Group
+
+	telemetry *telemetry
+}
+
+// Namespace 返回在当前前缀后追加 name + ":" 的客户端，与 r 共用连接池和所有配置
+// 返回的客户端调用 Close 不会关闭连接池，需要关闭 r
+func (r *Redisgo) Namespace(name string) *Redisgo {
+	child := *r
+	child.commands = commands{&child}
+	child.prefix = r.prefix + name + ":"
+	child.namespace = true
+	return &child
+}
+
+// KeyPrefix 返回当前客户端为 key 加上的前缀
+func (r *Redisgo) KeyPrefix() string {
+	return r.prefix
 }
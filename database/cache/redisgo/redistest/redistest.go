@@ -0,0 +1,554 @@
+// Package redistest redisgo.Client 的一致性测试，真实的 Redisgo 和 MemoryClient 需要得到相同的结果
+//
+//	func TestMemory(t *testing.T) {
+//		redistest.Run(t, redistest.Memory)
+//	}
+//
+//	func TestRedis(t *testing.T) {
+//		redistest.Run(t, redistest.Redis(redisgo.WithAddr("127.0.0.1:6379")))
+//	}
+package redistest
+
+import (
+	"context"
+	"github.com/aloeproject/toolbox/database/cache/redisgo"
+	"github.com/gomodule/redigo/redis"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clock 手动推进的时钟，通过 redisgo.WithMemoryClock(clock.Now) 控制 MemoryClient 的过期时间
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance 将时钟向后推进 d
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Factory 为每个子测试创建客户端，advance 使客户端看到的时间经过 d
+type Factory func(t *testing.T) (c redisgo.Client, advance func(d time.Duration))
+
+// Memory 使用 MemoryClient 和手动推进的时钟
+func Memory(t *testing.T) (redisgo.Client, func(d time.Duration)) {
+	clock := NewClock(time.Now())
+	c := redisgo.NewMemoryClient(redisgo.WithMemoryClock(clock.Now))
+	t.Cleanup(func() {
+		c.Close()
+	})
+	return c, clock.Advance
+}
+
+// Redis 连接真实的 redis，无法连接时跳过测试，时间只能通过 sleep 经过
+func Redis(opts ...redisgo.Option) Factory {
+	return func(t *testing.T) (redisgo.Client, func(d time.Duration)) {
+		c := redisgo.NewRedisgo(opts...)
+		if _, err := c.DoCtx(context.Background(), "PING"); err != nil {
+			c.Close()
+			t.Skip("redis unavailable: ", err)
+		}
+		t.Cleanup(func() {
+			c.Close()
+		})
+		return c, time.Sleep
+	}
+}
+
+type env struct {
+	t       *testing.T
+	ctx     context.Context
+	c       redisgo.Client
+	advance func(d time.Duration)
+}
+
+// key 返回子测试使用的 key，使用前后都会删除，避免与真实 redis 中的数据冲突
+func (e *env) key(name string) string {
+	k := "redistest:" + e.t.Name() + ":" + name
+	e.c.Del(e.ctx, k)
+	e.t.Cleanup(func() {
+		e.c.Del(context.Background(), k)
+	})
+	return k
+}
+
+func (e *env) noErr(err error) {
+	e.t.Helper()
+	if err != nil {
+		e.t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func (e *env) equal(got, want interface{}) {
+	e.t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		e.t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+var cases = []struct {
+	name string
+	fn   func(e *env)
+}{
+	{"Keys", testKeys},
+	{"Expire", testExpire},
+	{"String", testString},
+	{"Counter", testCounter},
+	{"List", testList},
+	{"BlockingPop", testBlockingPop},
+	{"Hash", testHash},
+	{"HashStruct", testHashStruct},
+	{"Set", testSet},
+	{"SortedSet", testSortedSet},
+	{"SortedSetRange", testSortedSetRange},
+	{"WrongType", testWrongType},
+}
+
+// Run 对 newClient 创建的客户端执行所有一致性测试
+func Run(t *testing.T, newClient Factory) {
+	for _, tc := range cases {
+		fn := tc.fn
+		t.Run(tc.name, func(t *testing.T) {
+			c, advance := newClient(t)
+			fn(&env{t: t, ctx: context.Background(), c: c, advance: advance})
+		})
+	}
+}
+
+func testKeys(e *env) {
+	a, b := e.key("a"), e.key("b")
+	ok, err := e.c.Exists(e.ctx, a)
+	e.noErr(err)
+	e.equal(ok, false)
+
+	_, err = e.c.MSet(e.ctx, a, "1", b, "2")
+	e.noErr(err)
+	ok, err = e.c.Exists(e.ctx, a)
+	e.noErr(err)
+	e.equal(ok, true)
+
+	n, err := e.c.Del(e.ctx, a, b, e.key("missing"))
+	e.noErr(err)
+	e.equal(n, 2)
+	ok, err = e.c.Exists(e.ctx, b)
+	e.noErr(err)
+	e.equal(ok, false)
+
+	reply, err := e.c.DoCtx(e.ctx, "TYPE", a)
+	e.noErr(err)
+	e.equal(reply, "none")
+}
+
+func testExpire(e *env) {
+	a, b := e.key("a"), e.key("b")
+	ttl, err := e.c.TTL(e.ctx, a)
+	e.noErr(err)
+	e.equal(ttl, int64(-2))
+
+	_, err = e.c.Set(e.ctx, a, "v")
+	e.noErr(err)
+	ttl, err = e.c.TTL(e.ctx, a)
+	e.noErr(err)
+	e.equal(ttl, int64(-1))
+
+	e.noErr(e.c.Expire(e.ctx, a, time.Second))
+	ttl, err = e.c.TTL(e.ctx, a)
+	e.noErr(err)
+	e.equal(ttl, int64(1))
+
+	_, err = e.c.SetExSecond(e.ctx, b, "v", 10)
+	e.noErr(err)
+
+	e.advance(1100 * time.Millisecond)
+	ok, err := e.c.Exists(e.ctx, a)
+	e.noErr(err)
+	e.equal(ok, false)
+	v, err := e.c.Get(e.ctx, a)
+	e.noErr(err)
+	e.equal(v, []byte(nil))
+	ok, err = e.c.Exists(e.ctx, b)
+	e.noErr(err)
+	e.equal(ok, true)
+
+	// 重新写入会清除过期时间
+	_, err = e.c.Set(e.ctx, b, "v2")
+	e.noErr(err)
+	ttl, err = e.c.TTL(e.ctx, b)
+	e.noErr(err)
+	e.equal(ttl, int64(-1))
+}
+
+func testString(e *env) {
+	a, b, c := e.key("a"), e.key("b"), e.key("c")
+
+	v, err := e.c.Get(e.ctx, a)
+	e.noErr(err)
+	e.equal(v, []byte(nil))
+	s, err := e.c.GetString(e.ctx, a)
+	e.noErr(err)
+	e.equal(s, "")
+
+	ok, err := e.c.Set(e.ctx, a, "hello")
+	e.noErr(err)
+	e.equal(ok, true)
+	v, err = e.c.Get(e.ctx, a)
+	e.noErr(err)
+	e.equal(v, []byte("hello"))
+
+	n, err := e.c.SetNX(e.ctx, a, "other")
+	e.noErr(err)
+	e.equal(n, 0)
+	n, err = e.c.SetNX(e.ctx, b, 42)
+	e.noErr(err)
+	e.equal(n, 1)
+	i, err := e.c.GetInt(e.ctx, b)
+	e.noErr(err)
+	e.equal(i, 42)
+	i64, err := e.c.GetInt64(e.ctx, b)
+	e.noErr(err)
+	e.equal(i64, int64(42))
+
+	// key 已存在时 SET NX 返回 nil
+	set, err := e.c.SetNEX(e.ctx, a, "other", 10)
+	e.equal(err, redis.ErrNil)
+	e.equal(set, false)
+	set, err = e.c.SetNEX(e.ctx, c, 1.5, 10)
+	e.noErr(err)
+	e.equal(set, true)
+	f, err := e.c.GetFloat64(e.ctx, c)
+	e.noErr(err)
+	e.equal(f, 1.5)
+
+	values, err := e.c.MGet(e.ctx, a, e.key("missing"), b)
+	e.noErr(err)
+	e.equal(values, [][]byte{[]byte("hello"), nil, []byte("42")})
+}
+
+func testCounter(e *env) {
+	a := e.key("a")
+	n, err := e.c.Incr(e.ctx, a)
+	e.noErr(err)
+	e.equal(n, int64(1))
+	n, err = e.c.Incrby(e.ctx, a, 10)
+	e.noErr(err)
+	e.equal(n, int64(11))
+	n, err = e.c.Incrby(e.ctx, a, -20)
+	e.noErr(err)
+	e.equal(n, int64(-9))
+
+	_, err = e.c.Set(e.ctx, a, "abc")
+	e.noErr(err)
+	_, err = e.c.Incr(e.ctx, a)
+	if _, ok := err.(redis.Error); !ok {
+		e.t.Fatalf("INCR on non-integer value: got %v, want redis.Error", err)
+	}
+}
+
+func testList(e *env) {
+	a := e.key("a")
+	v, err := e.c.RPop(e.ctx, a)
+	e.noErr(err)
+	e.equal(v, "")
+
+	e.noErr(e.c.LPush(e.ctx, a, "b", "a"))
+	e.noErr(e.c.Send(e.ctx, a, "c", "d"))
+	n, err := e.c.LLen(e.ctx, a)
+	e.noErr(err)
+	e.equal(n, int64(4))
+
+	items, err := redis.Strings(e.c.DoCtx(e.ctx, "LRANGE", a, 0, -1))
+	e.noErr(err)
+	e.equal(items, []string{"a", "b", "c", "d"})
+
+	for _, want := range []string{"d", "c", "b", "a"} {
+		v, err = e.c.RPop(e.ctx, a)
+		e.noErr(err)
+		e.equal(v, want)
+	}
+	// 元素全部取出后 key 被删除
+	ok, err := e.c.Exists(e.ctx, a)
+	e.noErr(err)
+	e.equal(ok, false)
+}
+
+func testBlockingPop(e *env) {
+	a, b, z := e.key("a"), e.key("b"), e.key("z")
+
+	key, value, err := e.c.BLPop(e.ctx, 100*time.Millisecond, a, b)
+	e.noErr(err)
+	e.equal([]string{key, value}, []string{"", ""})
+
+	e.noErr(e.c.Send(e.ctx, b, "1", "2"))
+	key, value, err = e.c.BLPop(e.ctx, time.Second, a, b)
+	e.noErr(err)
+	e.equal([]string{key, value}, []string{b, "1"})
+	key, value, err = e.c.BRPop(e.ctx, time.Second, a, b)
+	e.noErr(err)
+	e.equal([]string{key, value}, []string{b, "2"})
+
+	// 阻塞期间写入的元素
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		e.c.LPush(context.Background(), a, "late")
+	}()
+	key, value, err = e.c.BLPop(e.ctx, 5*time.Second, a, b)
+	e.noErr(err)
+	e.equal([]string{key, value}, []string{a, "late"})
+
+	ctx, cancel := context.WithTimeout(e.ctx, 100*time.Millisecond)
+	defer cancel()
+	_, _, err = e.c.BLPop(ctx, 0, a)
+	e.equal(err, context.DeadlineExceeded)
+
+	_, err = e.c.ZAdd(e.ctx, z, 2, "two", 1, "one")
+	e.noErr(err)
+	key, member, score, err := e.c.BZPopMin(e.ctx, time.Second, z)
+	e.noErr(err)
+	e.equal([]interface{}{key, member, score}, []interface{}{z, "one", float64(1)})
+}
+
+func testHash(e *env) {
+	h := e.key("h")
+	s, err := e.c.HGet(e.ctx, h, "f")
+	e.noErr(err)
+	e.equal(s, "")
+	_, err = e.c.HGetBytes(e.ctx, h, "f")
+	e.equal(err, redis.ErrNil)
+	ok, err := e.c.HExists(e.ctx, h, "f")
+	e.noErr(err)
+	e.equal(ok, false)
+
+	n, err := e.c.HSet(e.ctx, h, "name", "redis")
+	e.noErr(err)
+	e.equal(n, 1)
+	n, err = e.c.HSet(e.ctx, h, "name", "memory")
+	e.noErr(err)
+	e.equal(n, 0)
+	res, err := e.c.HMSet(e.ctx, h, "int", 7, "float", 2.5, "uint", uint64(1)<<63)
+	e.noErr(err)
+	e.equal(res, "OK")
+
+	s, err = e.c.HGet(e.ctx, h, "name")
+	e.noErr(err)
+	e.equal(s, "memory")
+	b, err := e.c.HGetBytes(e.ctx, h, "name")
+	e.noErr(err)
+	e.equal(b, []byte("memory"))
+	i, err := e.c.HGetInt(e.ctx, h, "int")
+	e.noErr(err)
+	e.equal(i, 7)
+	f, err := e.c.HGetFloat(e.ctx, h, "float")
+	e.noErr(err)
+	e.equal(f, 2.5)
+	u, err := e.c.HGetUint64(e.ctx, h, "uint")
+	e.noErr(err)
+	e.equal(u, uint64(1)<<63)
+
+	values, err := e.c.HMGet(e.ctx, h, "name", "missing", "int")
+	e.noErr(err)
+	e.equal(values, []string{"memory", "", "7"})
+
+	all, err := e.c.HGetAll(e.ctx, h)
+	e.noErr(err)
+	e.equal(all, map[string]string{"name": "memory", "int": "7", "float": "2.5", "uint": "9223372036854775808"})
+	keys, err := e.c.HKeys(e.ctx, h)
+	e.noErr(err)
+	e.equal(len(keys), 4)
+
+	i64, err := e.c.HIncrby(e.ctx, h, "int", 3)
+	e.noErr(err)
+	e.equal(i64, int64(10))
+	i64, err = e.c.HIncrby(e.ctx, h, "counter", -1)
+	e.noErr(err)
+	e.equal(i64, int64(-1))
+	f, err = e.c.HIncrbyFloat(e.ctx, h, "float", 0.25)
+	e.noErr(err)
+	e.equal(f, 2.75)
+
+	n, err = e.c.HDel(e.ctx, h, "name", "missing")
+	e.noErr(err)
+	e.equal(n, 1)
+	n, err = e.c.HDel(e.ctx, h, "int", "float", "uint", "counter")
+	e.noErr(err)
+	e.equal(n, 4)
+	exists, err := e.c.Exists(e.ctx, h)
+	e.noErr(err)
+	e.equal(exists, false)
+}
+
+type hashModel struct {
+	Name  string  `redis:"name"`
+	Age   int     `redis:"age"`
+	Score float64 `redis:"score"`
+	VIP   bool    `redis:"vip"`
+}
+
+func testHashStruct(e *env) {
+	h := e.key("h")
+	var got hashModel
+	e.equal(e.c.HGetStruct(e.ctx, h, &got), redisgo.ErrKeyNoExist)
+
+	want := hashModel{Name: "tom", Age: 18, Score: 99.5, VIP: true}
+	_, err := e.c.HMSetStruct(e.ctx, h, &want)
+	e.noErr(err)
+	e.noErr(e.c.HGetStruct(e.ctx, h, &got))
+	e.equal(got, want)
+}
+
+func testSet(e *env) {
+	s := e.key("s")
+	members, err := e.c.SMembers(e.ctx, s)
+	e.noErr(err)
+	e.equal(len(members), 0)
+
+	n, err := e.c.SAdd(e.ctx, s, "a", "b", "a", 1)
+	e.noErr(err)
+	e.equal(n, 3)
+	card, err := e.c.SCard(e.ctx, s)
+	e.noErr(err)
+	e.equal(card, int64(3))
+	ok, err := e.c.SIsMember(e.ctx, s, "1")
+	e.noErr(err)
+	e.equal(ok, true)
+	ok, err = e.c.SIsMember(e.ctx, s, "c")
+	e.noErr(err)
+	e.equal(ok, false)
+
+	members, err = e.c.SMembers(e.ctx, s)
+	e.noErr(err)
+	seen := make(map[string]bool)
+	for _, m := range members {
+		seen[m] = true
+	}
+	e.equal(seen, map[string]bool{"a": true, "b": true, "1": true})
+
+	n, err = e.c.SRem(e.ctx, s, "a", "c")
+	e.noErr(err)
+	e.equal(n, 1)
+}
+
+func testSortedSet(e *env) {
+	z := e.key("z")
+	_, err := e.c.ZScore(e.ctx, z, "a")
+	e.noErr(err)
+	card, err := e.c.ZCard(e.ctx, z)
+	e.noErr(err)
+	e.equal(card, 0)
+
+	n, err := e.c.ZAdd(e.ctx, z, 3, "c", 1, "a", 2, "b")
+	e.noErr(err)
+	e.equal(n, 3)
+	n, err = e.c.ZAdd(e.ctx, z, 5, "c", 4, "d")
+	e.noErr(err)
+	e.equal(n, 1)
+	n, err = e.c.ZAdd(e.ctx, z, "NX", 100, "a", 6, "e")
+	e.noErr(err)
+	e.equal(n, 1)
+
+	score, err := e.c.ZScore(e.ctx, z, "c")
+	e.noErr(err)
+	e.equal(score, float64(5))
+	rank, err := e.c.ZRank(e.ctx, z, "b")
+	e.noErr(err)
+	e.equal(rank, 1)
+
+	n, err = e.c.ZIncrby(e.ctx, z, 10, "a")
+	e.noErr(err)
+	e.equal(n, 11)
+	rank, err = e.c.ZRank(e.ctx, z, "a")
+	e.noErr(err)
+	e.equal(rank, 4)
+
+	n, err = e.c.ZCount(e.ctx, z, 2, 5)
+	e.noErr(err)
+	e.equal(n, 3)
+
+	n, err = e.c.ZRem(e.ctx, z, "a", "missing")
+	e.noErr(err)
+	e.equal(n, 1)
+	// 删除排名最低的两个成员
+	n, err = e.c.ZRemrangebyrank(e.ctx, z, 0, 1)
+	e.noErr(err)
+	e.equal(n, 2)
+	members, err := e.c.ZRange(e.ctx, z, 0, -1)
+	e.noErr(err)
+	e.equal(members, []string{"c", "e"})
+
+	_, err = e.c.DoCtx(e.ctx, "ZPOPMIN", z, -1)
+	e.equal(err, redis.Error("ERR value is out of range, must be positive"))
+	members, err = redis.Strings(e.c.DoCtx(e.ctx, "ZPOPMIN", z, 0))
+	e.noErr(err)
+	e.equal(members, []string{})
+	members, err = redis.Strings(e.c.DoCtx(e.ctx, "ZPOPMIN", z))
+	e.noErr(err)
+	e.equal(members, []string{"c", "5"})
+}
+
+func testSortedSetRange(e *env) {
+	z := e.key("z")
+	_, err := e.c.ZAdd(e.ctx, z, 1, "10", 2, "20", 2, "21", 3.5, "30")
+	e.noErr(err)
+
+	members, err := e.c.ZRange(e.ctx, z, 1, 2)
+	e.noErr(err)
+	e.equal(members, []string{"20", "21"})
+	ints, err := e.c.ZRangeInt(e.ctx, z, 0, -1)
+	e.noErr(err)
+	e.equal(ints, []int{10, 20, 21, 30})
+	withScores, err := e.c.ZRangeWithScore(e.ctx, z, 0, 1)
+	e.noErr(err)
+	e.equal(withScores, []string{"10", "1", "20", "2"})
+	withScores, err = e.c.ZRevRangeWithScore(e.ctx, z, 0, 0)
+	e.noErr(err)
+	e.equal(withScores, []string{"30", "3.5"})
+	members, err = e.c.Zrevrange(e.ctx, z, 0, -1)
+	e.noErr(err)
+	e.equal(members, []string{"30", "21", "20", "10"})
+
+	members, err = e.c.Zrevrangebyscore(e.ctx, z, "+inf", "(1")
+	e.noErr(err)
+	e.equal(members, []string{"30", "21", "20"})
+	members, err = e.c.Zrevrangebyscore(e.ctx, z, 3, "-inf", "WITHSCORES", "LIMIT", 1, 2)
+	e.noErr(err)
+	e.equal(members, []string{"20", "2", "10", "1"})
+	ints, err = e.c.ZrevrangebyscoreInt(e.ctx, z, 2, 2)
+	e.noErr(err)
+	e.equal(ints, []int{21, 20})
+
+	members, err = e.c.ZRange(e.ctx, e.key("missing"), 0, -1)
+	e.noErr(err)
+	e.equal(members, []string{})
+}
+
+func testWrongType(e *env) {
+	a := e.key("a")
+	_, err := e.c.Set(e.ctx, a, "v")
+	e.noErr(err)
+	for name, fn := range map[string]func() error{
+		"HGET":  func() error { _, err := e.c.HGet(e.ctx, a, "f"); return err },
+		"SADD":  func() error { _, err := e.c.SAdd(e.ctx, a, "m"); return err },
+		"ZADD":  func() error { _, err := e.c.ZAdd(e.ctx, a, 1, "m"); return err },
+		"LPUSH": func() error { return e.c.LPush(e.ctx, a, "v") },
+	} {
+		err := fn()
+		if re, ok := err.(redis.Error); !ok || !strings.HasPrefix(string(re), "WRONGTYPE") {
+			e.t.Fatalf("%s: got %v, want WRONGTYPE error", name, err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package redisgo
+
+import (
+	"context"
+	"github.com/gomodule/redigo/redis"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 读命令的路由策略
+const (
+	// ReadMasterOnly 所有命令都在主节点执行
+	ReadMasterOnly = "master"
+	// ReadPreferReplica 读命令随机选择一个健康的从节点，没有健康的从节点时使用主节点
+	ReadPreferReplica = "prefer_replica"
+	// ReadRoundRobin 读命令在主节点和健康的从节点之间轮询
+	ReadRoundRobin = "round_robin"
+	// ReadLowestLatency 读命令选择 PING 延迟最低的节点
+	ReadLowestLatency = "lowest_latency"
+)
+
+// readCommands 只读命令，可以路由到从节点
+var readCommands = map[string]struct{}{
+	"GET": {}, "MGET": {}, "STRLEN": {}, "GETRANGE": {}, "GETBIT": {}, "BITCOUNT": {},
+	"EXISTS": {}, "TTL": {}, "PTTL": {}, "TYPE": {},
+	"HGET": {}, "HMGET": {}, "HGETALL": {}, "HKEYS": {}, "HVALS": {}, "HLEN": {}, "HEXISTS": {}, "HSTRLEN": {}, "HSCAN": {},
+	"SMEMBERS": {}, "SISMEMBER": {}, "SMISMEMBER": {}, "SCARD": {}, "SRANDMEMBER": {}, "SINTER": {}, "SUNION": {}, "SDIFF": {}, "SSCAN": {},
+	"ZRANGE": {}, "ZREVRANGE": {}, "ZRANGEBYSCORE": {}, "ZREVRANGEBYSCORE": {}, "ZRANGEBYLEX": {}, "ZCOUNT": {}, "ZCARD": {},
+	"ZRANK": {}, "ZREVRANK": {}, "ZSCORE": {}, "ZMSCORE": {}, "ZSCAN": {},
+	"LLEN": {}, "LRANGE": {}, "LINDEX": {},
+	"XRANGE": {}, "XREVRANGE": {}, "XLEN": {},
+	"SCAN": {}, "KEYS": {},
+}
+
+func isReadCommand(cmd string) bool {
+	_, ok := readCommands[strings.ToUpper(cmd)]
+	return ok
+}
+
+type replicaNode struct {
+	addr    string
+	pool    *redis.Pool
+	healthy int32
+	// PING 延迟的滑动平均值，单位纳秒
+	latency int64
+}
+
+func (n *replicaNode) isHealthy() bool {
+	return atomic.LoadInt32(&n.healthy) == 1
+}
+
+func (n *replicaNode) setHealthy(ok bool) {
+	if ok {
+		atomic.StoreInt32(&n.healthy, 1)
+	} else {
+		atomic.StoreInt32(&n.healthy, 0)
+	}
+}
+
+func (n *replicaNode) observe(d time.Duration) {
+	old := atomic.LoadInt64(&n.latency)
+	if old == 0 {
+		atomic.StoreInt64(&n.latency, int64(d))
+		return
+	}
+	atomic.StoreInt64(&n.latency, old*4/5+int64(d)/5)
+}
+
+// replicas 从节点连接池，定时检查从节点的健康状态和延迟
+type replicas struct {
+	policy  string
+	master  *replicaNode
+	nodes   []*replicaNode
+	counter uint64
+	cancel  context.CancelFunc
+}
+
+func newReplicas(policy string, interval time.Duration, master *redis.Pool, addrs []string, newPool func(addr string) *redis.Pool) *replicas {
+	s := &replicas{
+		policy: policy,
+		master: &replicaNode{pool: master, healthy: 1},
+	}
+	for _, addr := range addrs {
+		s.nodes = append(s.nodes, &replicaNode{addr: addr, pool: newPool(addr)})
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.check()
+	go s.run(ctx, interval)
+	return s
+}
+
+// pick 返回执行读命令的连接池，返回 nil 时使用主节点，每次读命令都会调用，不分配内存
+func (s *replicas) pick() *replicaNode {
+	healthy := 0
+	for _, n := range s.nodes {
+		if n.isHealthy() {
+			healthy++
+		}
+	}
+	if healthy == 0 {
+		return nil
+	}
+
+	switch s.policy {
+	case ReadPreferReplica:
+		return s.healthyAt(rand.Intn(healthy))
+	case ReadRoundRobin:
+		i := int(atomic.AddUint64(&s.counter, 1) % uint64(healthy+1))
+		if i == healthy {
+			return nil
+		}
+		return s.healthyAt(i)
+	case ReadLowestLatency:
+		// 主节点 PING 失败时不参与比较，避免延迟为 0 的主节点总是被选中
+		var best *replicaNode
+		bestLatency := int64(math.MaxInt64)
+		if s.master.isHealthy() {
+			bestLatency = atomic.LoadInt64(&s.master.latency)
+		}
+		for _, n := range s.nodes {
+			if !n.isHealthy() {
+				continue
+			}
+			if l := atomic.LoadInt64(&n.latency); l < bestLatency {
+				best, bestLatency = n, l
+			}
+		}
+		return best
+	default:
+		return nil
+	}
+}
+
+// healthyAt 返回第 i 个健康的从节点，健康状态在两次遍历之间变化时可能返回 nil
+func (s *replicas) healthyAt(i int) *replicaNode {
+	for _, n := range s.nodes {
+		if !n.isHealthy() {
+			continue
+		}
+		if i == 0 {
+			return n
+		}
+		i--
+	}
+	return nil
+}
+
+func (s *replicas) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+func (s *replicas) check() {
+	if s.policy == ReadLowestLatency {
+		s.ping(s.master, false)
+	}
+	for _, n := range s.nodes {
+		s.ping(n, true)
+	}
+}
+
+// ping 检查节点延迟，从节点还需要确认与主节点的复制连接正常
+func (s *replicas) ping(n *replicaNode, replica bool) {
+	c := n.pool.Get()
+	defer c.Close()
+
+	start := time.Now()
+	if _, err := c.Do("PING"); err != nil {
+		n.setHealthy(false)
+		return
+	}
+	n.observe(time.Since(start))
+
+	if !replica {
+		n.setHealthy(true)
+		return
+	}
+
+	// ROLE 返回 slave masterip masterport state offset
+	values, err := redis.Values(c.Do("ROLE"))
+	if err != nil || len(values) < 4 {
+		n.setHealthy(false)
+		return
+	}
+	state, _ := redis.String(values[3], nil)
+	n.setHealthy(state == "connected")
+}
+
+func (s *replicas) close() {
+	s.cancel()
+	for _, n := range s.nodes {
+		n.pool.Close()
+	}
+}
+
+// execReplica 在从节点执行读命令，连接失败时标记为不健康并回退到主节点
+func (r *Redisgo) execReplica(ctx context.Context, cmd string, args ...interface{}) (interface{}, bool, error) {
+	n := r.replicas.pick()
+	if n == nil {
+		return nil, false, nil
+	}
+
+	client, err := n.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer client.Close()
+
+	setPeer(ctx, n.addr)
+	reply, err := doContext(ctx, client, cmd, args...)
+	if _, ok := err.(redis.Error); err != nil && err != redis.ErrNil && !ok && ctx.Err() == nil {
+		n.setHealthy(false)
+		return nil, false, nil
+	}
+	return reply, true, err
+}
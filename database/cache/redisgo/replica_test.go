@@ -0,0 +1,43 @@
+package redisgo
+
+import (
+	"testing"
+)
+
+func TestReplicasPick(t *testing.T) {
+	a := &replicaNode{addr: "a", healthy: 1, latency: 300}
+	b := &replicaNode{addr: "b", healthy: 1, latency: 200}
+	c := &replicaNode{addr: "c", healthy: 0, latency: 100}
+	master := &replicaNode{healthy: 1, latency: 250}
+	s := &replicas{policy: ReadLowestLatency, master: master, nodes: []*replicaNode{a, b, c}}
+
+	if got := s.pick(); got != b {
+		t.Errorf("lowest latency: got %v, want b", got)
+	}
+	master.latency = 50
+	if got := s.pick(); got != nil {
+		t.Errorf("lowest latency master: got %v, want master", got)
+	}
+	// PING 失败的主节点延迟保持旧值，不应再被选中
+	master.latency = 0
+	master.setHealthy(false)
+	if got := s.pick(); got != b {
+		t.Errorf("lowest latency unhealthy master: got %v, want b", got)
+	}
+
+	s.policy = ReadRoundRobin
+	seen := map[*replicaNode]int{}
+	for i := 0; i < 30; i++ {
+		seen[s.pick()]++
+	}
+	if seen[a] != 10 || seen[b] != 10 || seen[nil] != 10 || seen[c] != 0 {
+		t.Errorf("round robin: got %v", seen)
+	}
+
+	for _, policy := range []string{ReadPreferReplica, ReadRoundRobin, ReadLowestLatency} {
+		s.policy = policy
+		if n := testing.AllocsPerRun(100, func() { s.pick() }); n != 0 {
+			t.Errorf("%s: %v allocs per pick", policy, n)
+		}
+	}
+}
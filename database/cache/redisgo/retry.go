@@ -0,0 +1,216 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy 命令失败后的重试策略
+// 服务端明确拒绝执行的错误(LOADING、READONLY、CLUSTERDOWN 等)和建立连接失败时任何命令都可以重试，
+// 超时、连接被重置等无法确定命令是否已执行的错误只重试幂等的命令，除非设置了 RetryWrites
+type RetryPolicy struct {
+	// MaxRetries 最多重试的次数，为 0 时不重试
+	MaxRetries int
+	// MinBackoff 第一次重试前等待时间的上限，之后每次翻倍，实际等待时间在 [0, 上限) 之间随机
+	MinBackoff time.Duration
+	// MaxBackoff 每次等待时间的上限
+	MaxBackoff time.Duration
+	// MaxElapsed 从第一次执行开始超过该时间后不再重试，为 0 时不限制
+	MaxElapsed time.Duration
+	// RetryWrites 无法确定是否已执行时，非幂等的写命令也重试，命令可能被执行多次
+	RetryWrites bool
+	// Idempotent 除内置的命令之外，可以安全重试的命令，如只读的 Lua 脚本使用的 EVALSHA
+	Idempotent []string
+}
+
+// DefaultRetryPolicy 只配置了 Retry 次数时使用的策略
+func DefaultRetryPolicy(maxRetries int) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: maxRetries,
+		MinBackoff: 8 * time.Millisecond,
+		MaxBackoff: 512 * time.Millisecond,
+	}
+}
+
+// idempotentCommands 重复执行结果相同的写命令，只读命令见 readCommands
+var idempotentCommands = map[string]struct{}{
+	"SET": {}, "SETEX": {}, "PSETEX": {}, "MSET": {}, "DEL": {}, "UNLINK": {},
+	"EXPIRE": {}, "PEXPIRE": {}, "EXPIREAT": {}, "PEXPIREAT": {}, "PERSIST": {},
+	"HSET": {}, "HMSET": {}, "HDEL": {}, "SADD": {}, "SREM": {}, "ZADD": {}, "ZREM": {},
+	"PING": {}, "ECHO": {}, "INFO": {}, "TIME": {}, "ROLE": {}, "DBSIZE": {}, "SCRIPT": {},
+	"WATCH": {}, "UNWATCH": {}, "SELECT": {},
+	"XRANGE": {}, "XREVRANGE": {}, "XLEN": {}, "XPENDING": {}, "XINFO": {},
+}
+
+// retryClass 错误是否可以重试
+type retryClass int
+
+const (
+	retryNever retryClass = iota
+	// retryIdempotent 命令可能已经执行，只有幂等的命令可以重试
+	retryIdempotent
+	// retryAlways 命令确定没有执行
+	retryAlways
+)
+
+// classifyError 对执行命令返回的错误分类
+func classifyError(err error) retryClass {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return retryNever
+	}
+
+	if e, ok := err.(redis.Error); ok {
+		msg := string(e)
+		for _, prefix := range []string{"LOADING", "READONLY", "CLUSTERDOWN", "TRYAGAIN", "MASTERDOWN"} {
+			if strings.HasPrefix(msg, prefix) {
+				return retryAlways
+			}
+		}
+		return retryNever
+	}
+
+	switch err {
+	case redis.ErrPoolExhausted, ErrConnExhausted, ErrClusterNoNodes:
+		return retryAlways
+	case ErrTimeout, io.EOF, io.ErrUnexpectedEOF:
+		return retryIdempotent
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return retryAlways
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return retryAlways
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) {
+		return retryIdempotent
+	}
+	if strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "connection reset") {
+		return retryIdempotent
+	}
+	return retryNever
+}
+
+// isIdempotent 重复执行命令不会改变结果，SET NX/GET 和 ZADD INCR 等带条件的写入除外
+func (p *RetryPolicy) isIdempotent(cmd string, args []interface{}) bool {
+	cmd = strings.ToUpper(cmd)
+	for _, c := range p.Idempotent {
+		if strings.EqualFold(c, cmd) {
+			return true
+		}
+	}
+	if isReadCommand(cmd) {
+		return true
+	}
+	if _, ok := idempotentCommands[cmd]; !ok {
+		return false
+	}
+	switch cmd {
+	case "SET", "ZADD":
+		for _, a := range args {
+			switch strings.ToUpper(keyString(a)) {
+			case "NX", "XX", "GET", "INCR", "GT", "LT", "CH":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// shouldRetry attempt 为已经重试的次数，start 为第一次执行的时间
+func (p *RetryPolicy) shouldRetry(ctx context.Context, cmd string, args []interface{}, err error, attempt int, start time.Time) bool {
+	return p.retryable(ctx, classifyError(err), attempt, start, func() bool {
+		return p.isIdempotent(cmd, args)
+	})
+}
+
+// shouldRetryPipeline 与 shouldRetry 相同，written 为 true 时命令可能已经部分发出，
+// 任何错误都按无法确定是否执行处理，只有全部命令都幂等时才重试
+func (p *RetryPolicy) shouldRetryPipeline(ctx context.Context, cmds []*pipeCmd, err error, written bool, attempt int, start time.Time) bool {
+	class := classifyError(err)
+	if written && class == retryAlways {
+		class = retryIdempotent
+	}
+	return p.retryable(ctx, class, attempt, start, func() bool {
+		for _, c := range cmds {
+			if !p.isIdempotent(c.name, c.args) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (p *RetryPolicy) retryable(ctx context.Context, class retryClass, attempt int, start time.Time, idempotent func() bool) bool {
+	if attempt >= p.MaxRetries || ctx.Err() != nil {
+		return false
+	}
+	if p.MaxElapsed > 0 && time.Since(start) >= p.MaxElapsed {
+		return false
+	}
+	switch class {
+	case retryAlways:
+		return true
+	case retryIdempotent:
+		return p.RetryWrites || idempotent()
+	default:
+		return false
+	}
+}
+
+// backoff 第 attempt 次重试前的等待时间，使用 full jitter
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	if p.MinBackoff <= 0 {
+		return 0
+	}
+	d := p.MaxBackoff
+	if attempt < 31 {
+		if b := p.MinBackoff << uint(attempt); b > 0 && (d <= 0 || b < d) {
+			d = b
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// wait 等待重试，ctx 结束时返回 false
+func (p *RetryPolicy) wait(ctx context.Context, attempt int, start time.Time) bool {
+	d := p.backoff(attempt)
+	if p.MaxElapsed > 0 {
+		if remain := p.MaxElapsed - time.Since(start); d > remain {
+			return false
+		}
+	}
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// newRetryPolicy 未设置 RetryPolicy 时，按 Retry 次数使用默认策略
+func newRetryPolicy(o *RedisConfig) *RetryPolicy {
+	if o.RetryPolicy != nil {
+		p := *o.RetryPolicy
+		return &p
+	}
+	p := DefaultRetryPolicy(o.Retry)
+	return &p
+}
@@ -0,0 +1,36 @@
+package redisgo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShouldRetryPipeline(t *testing.T) {
+	p := DefaultRetryPolicy(3)
+	ctx := context.Background()
+	reads := []*pipeCmd{{name: "GET", args: []interface{}{"a"}}, {name: "SET", args: []interface{}{"b", 1}}}
+	writes := []*pipeCmd{{name: "GET", args: []interface{}{"a"}}, {name: "INCRBY", args: []interface{}{"b", 1}}}
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		cmds    []*pipeCmd
+		err     error
+		written bool
+		want    bool
+	}{
+		{"pool exhausted before send", p, writes, ErrConnExhausted, false, true},
+		{"exhausted after write is uncertain", p, writes, ErrConnExhausted, true, false},
+		{"timeout idempotent", p, reads, ErrTimeout, true, true},
+		{"timeout non idempotent", p, writes, ErrTimeout, true, false},
+		{"retry writes", RetryPolicy{MaxRetries: 3, RetryWrites: true}, writes, ErrTimeout, true, true},
+		{"no retries", DefaultRetryPolicy(0), reads, ErrConnExhausted, false, false},
+		{"canceled", p, reads, context.Canceled, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.shouldRetryPipeline(ctx, tt.cmds, tt.err, tt.written, 0, time.Now()); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package redisgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"time"
+)
+
+const (
+	// 按模式批量删除或设置过期时间时每批处理的 key 数量
+	defaultScanBatch = 500
+)
+
+type scanOptions struct {
+	match string
+	count int
+	typ   string
+}
+
+type ScanOption func(*scanOptions)
+
+// WithScanMatch 只返回匹配 pattern 的元素，过滤在服务端每批取出后进行，单批结果可能为空
+func WithScanMatch(pattern string) ScanOption {
+	return func(o *scanOptions) {
+		o.match = pattern
+	}
+}
+
+// WithScanCount 每次迭代建议服务端检查的元素数量
+func WithScanCount(count int) ScanOption {
+	return func(o *scanOptions) {
+		o.count = count
+	}
+}
+
+// WithScanType 只返回指定类型的 key，仅对 SCAN 有效，需要 redis 6.0 以上
+func WithScanType(typ string) ScanOption {
+	return func(o *scanOptions) {
+		o.typ = typ
+	}
+}
+
+// ScanIterator 基于游标的迭代器，每次 Next 在当前批次用完后才向服务端请求下一批
+// 迭代期间被修改的元素可能重复返回或不返回，与 SCAN 命令的语义相同
+//
+//	it := r.Scan(WithScanMatch("user:*"))
+//	for it.Next(ctx) {
+//		key := it.Val()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type ScanIterator struct {
+	r    *Redisgo
+	cmd  string
+	key  string
+	opts scanOptions
+	// HSCAN、ZSCAN 每个元素由两项组成
+	pair bool
+
+	// 集群模式下 SCAN 依次遍历每个主节点
+	nodes []string
+
+	cursor  string
+	started bool
+	page    []string
+	pos     int
+	val     string
+	value   string
+	err     error
+}
+
+func newScanIterator(r *Redisgo, cmd, key string, opts []ScanOption) *ScanIterator {
+	it := &ScanIterator{
+		r:      r,
+		cmd:    cmd,
+		key:    key,
+		pair:   cmd == "HSCAN" || cmd == "ZSCAN",
+		cursor: "0",
+	}
+	for _, opt := range opts {
+		opt(&it.opts)
+	}
+	return it
+}
+
+// Scan 遍历当前数据库的 key，集群模式下遍历所有主节点
+func (r *Redisgo) Scan(opts ...ScanOption) *ScanIterator {
+	return newScanIterator(r, "SCAN", "", opts)
+}
+
+// HScan 遍历 hash 的 field，Val 返回 field，Value 返回对应的值
+func (r *Redisgo) HScan(key string, opts ...ScanOption) *ScanIterator {
+	return newScanIterator(r, "HSCAN", key, opts)
+}
+
+// SScan 遍历集合的成员
+func (r *Redisgo) SScan(key string, opts ...ScanOption) *ScanIterator {
+	return newScanIterator(r, "SSCAN", key, opts)
+}
+
+// ZScan 遍历有序集合，Val 返回成员，Value 返回分数
+func (r *Redisgo) ZScan(key string, opts ...ScanOption) *ScanIterator {
+	return newScanIterator(r, "ZSCAN", key, opts)
+}
+
+// Next 移动到下一个元素，迭代结束、出错或 ctx 取消时返回 false
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	step := 1
+	if it.pair {
+		step = 2
+	}
+	for it.pos+step > len(it.page) {
+		if it.started && it.cursor == "0" && !it.nextNode() {
+			return false
+		}
+		if err := ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		if err := it.fetch(ctx); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	it.val = it.page[it.pos]
+	if it.pair {
+		it.value = it.page[it.pos+1]
+	}
+	it.pos += step
+	return true
+}
+
+// Val 返回当前的 key、field 或成员
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Value 返回 HSCAN 当前 field 的值或 ZSCAN 当前成员的分数，其他迭代器返回空字符串
+func (it *ScanIterator) Value() string {
+	return it.value
+}
+
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// nextNode 集群模式下 SCAN 切换到下一个主节点，没有更多节点时返回 false
+func (it *ScanIterator) nextNode() bool {
+	if it.cmd != "SCAN" || it.r.cluster == nil || len(it.nodes) <= 1 {
+		return false
+	}
+	it.nodes = it.nodes[1:]
+	it.cursor = "0"
+	return true
+}
+
+func (it *ScanIterator) fetch(ctx context.Context) error {
+	var args []interface{}
+	if it.key != "" {
+		args = append(args, it.key)
+	}
+	args = append(args, it.cursor)
+	if it.opts.match != "" {
+		args = append(args, "MATCH", it.opts.match)
+	}
+	if it.opts.count > 0 {
+		args = append(args, "COUNT", it.opts.count)
+	}
+	if it.opts.typ != "" && it.cmd == "SCAN" {
+		args = append(args, "TYPE", it.opts.typ)
+	}
+
+	var (
+		reply interface{}
+		err   error
+	)
+	if it.cmd == "SCAN" && it.r.cluster != nil {
+		if !it.started {
+			it.nodes = it.r.cluster.masters()
+			if len(it.nodes) == 0 {
+				return ErrClusterNoNodes
+			}
+		}
+		// 直接在节点上执行，不经过 process，需要自己处理前缀
+		var f func(interface{}, error) (interface{}, error)
+		args, f, _ = it.r.prefixCommand(it.cmd, args, nil)
+		reply, err = it.r.cluster.doNode(ctx, it.nodes[0], it.cmd, args)
+		if f != nil {
+			reply, err = f(reply, err)
+		}
+	} else {
+		// 游标只在同一个节点上有效，不能路由到从节点
+		reply, err = it.r.Do(ctx, it.cmd, args...)
+	}
+	if err != nil {
+		return convertErr(err)
+	}
+
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return err
+	}
+	if len(values) != 2 {
+		return fmt.Errorf("redisgo: unexpected %s reply length %d", it.cmd, len(values))
+	}
+	if it.cursor, err = redis.String(values[0], nil); err != nil {
+		return err
+	}
+	if it.page, err = redis.Strings(values[1], nil); err != nil {
+		return err
+	}
+	it.pos = 0
+	it.started = true
+	return nil
+}
+
+// doNode 在指定节点上执行命令，用于 SCAN 这类需要遍历每个节点的命令
+func (c *cluster) doNode(ctx context.Context, addr, cmd string, args []interface{}) (interface{}, error) {
+	client, err := c.pool(addr).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return redis.DoContext(client, ctx, cmd, args...)
+}
+
+// DelMatch 删除所有匹配 pattern 的 key，每批删除 batch 个，batch 小于等于 0 时使用默认值，返回删除的数量
+func (r *Redisgo) DelMatch(ctx context.Context, pattern string, batch int) (int, error) {
+	return r.scanBatch(ctx, pattern, batch, func(keys []interface{}) (int, error) {
+		return r.Del(ctx, keys...)
+	})
+}
+
+// ExpireMatch 为所有匹配 pattern 的 key 设置过期时间，每批 batch 个，返回设置成功的数量
+func (r *Redisgo) ExpireMatch(ctx context.Context, pattern string, ttl time.Duration, batch int) (int, error) {
+	return r.scanBatch(ctx, pattern, batch, func(keys []interface{}) (int, error) {
+		p := r.Pipeline(ctx)
+		results := make([]*PipeResult[bool], 0, len(keys))
+		for _, k := range keys {
+			results = append(results, p.Expire(k.(string), ttl))
+		}
+		if err := p.Exec(); err != nil {
+			return 0, err
+		}
+		n := 0
+		for _, res := range results {
+			if res.Val() {
+				n++
+			}
+		}
+		return n, nil
+	})
+}
+
+func (r *Redisgo) scanBatch(ctx context.Context, pattern string, batch int, fn func(keys []interface{}) (int, error)) (int, error) {
+	if batch <= 0 {
+		batch = defaultScanBatch
+	}
+
+	total := 0
+	keys := make([]interface{}, 0, batch)
+	it := r.Scan(WithScanMatch(pattern), WithScanCount(batch))
+	for it.Next(ctx) {
+		keys = append(keys, it.Val())
+		if len(keys) < batch {
+			continue
+		}
+		n, err := fn(keys)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		keys = keys[:0]
+	}
+	if err := it.Err(); err != nil {
+		return total, err
+	}
+	if len(keys) > 0 {
+		n, err := fn(keys)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,189 @@
+package redisgo
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+	"sync"
+)
+
+var (
+	scriptsMu sync.RWMutex
+	scripts   = map[string]*Script{}
+)
+
+// Script Lua 脚本，创建时注册到全局，通过 EVALSHA 执行，服务端没有缓存时自动回退到 EVAL
+type Script struct {
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewScript 创建并注册脚本，keyCount 为 KEYS 的个数
+// keyCount 小于 0 时，执行时的第一个参数作为 KEYS 的个数
+// 脚本应当在包初始化时创建，同一个脚本只会注册一次
+func NewScript(keyCount int, src string) *Script {
+	h := sha1.New()
+	h.Write([]byte(src))
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	scriptsMu.Lock()
+	defer scriptsMu.Unlock()
+	if s, ok := scripts[hash]; ok && s.keyCount == keyCount {
+		return s
+	}
+	s := &Script{keyCount: keyCount, src: src, hash: hash}
+	scripts[hash] = s
+	return s
+}
+
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+func (s *Script) args(spec string, keysAndArgs []interface{}) []interface{} {
+	var args []interface{}
+	if s.keyCount < 0 {
+		args = make([]interface{}, 1+len(keysAndArgs))
+		args[0] = spec
+		copy(args[1:], keysAndArgs)
+	} else {
+		args = make([]interface{}, 2+len(keysAndArgs))
+		args[0] = spec
+		args[1] = s.keyCount
+		copy(args[2:], keysAndArgs)
+	}
+	return args
+}
+
+func (s *Script) exec(ctx context.Context, r *Redisgo, f func(interface{}, error) (interface{}, error), keysAndArgs []interface{}) (interface{}, error) {
+	reply, err := r.do(ctx, "EVALSHA", f, s.args(s.hash, keysAndArgs)...)
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "NOSCRIPT ") {
+		// EVAL 执行成功后服务端会缓存脚本，之后的 EVALSHA 不会再失败
+		reply, err = r.do(ctx, "EVAL", f, s.args(s.src, keysAndArgs)...)
+	}
+	return reply, err
+}
+
+// Load 将脚本加载到服务端缓存
+func (s *Script) Load(ctx context.Context, r *Redisgo) error {
+	_, err := r.do(ctx, "SCRIPT", nil, "LOAD", s.src)
+	return err
+}
+
+// Do 执行脚本并返回原始的 reply
+func (s *Script) Do(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (interface{}, error) {
+	return s.exec(ctx, r, nil, keysAndArgs)
+}
+
+func (s *Script) Int(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res int, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisInt, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.(int)
+	return
+}
+
+func (s *Script) Int64(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res int64, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisInt64, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.(int64)
+	return
+}
+
+func (s *Script) Ints(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res []int, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisInts, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.([]int)
+	return
+}
+
+func (s *Script) Bool(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res bool, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisBool, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.(bool)
+	return
+}
+
+func (s *Script) Float64(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res float64, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisFloat64, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.(float64)
+	return
+}
+
+func (s *Script) String(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res string, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisString, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.(string)
+	return
+}
+
+func (s *Script) Strings(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res []string, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisStrings, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.([]string)
+	return
+}
+
+func (s *Script) Bytes(ctx context.Context, r *Redisgo, keysAndArgs ...interface{}) (res []byte, err error) {
+	var reply interface{}
+	reply, err = s.exec(ctx, r, redisBytes, keysAndArgs)
+	if err != nil {
+		return
+	}
+	res = reply.([]byte)
+	return
+}
+
+// LoadScripts 将所有已注册的脚本加载到服务端
+func (r *Redisgo) LoadScripts(ctx context.Context) error {
+	for _, s := range registeredScripts() {
+		if err := s.Load(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registeredScripts() []*Script {
+	scriptsMu.RLock()
+	defer scriptsMu.RUnlock()
+	list := make([]*Script, 0, len(scripts))
+	for _, s := range scripts {
+		list = append(list, s)
+	}
+	return list
+}
+
+// preloadScripts 在新建连接上加载所有已注册的脚本
+func preloadScripts(c redis.Conn) error {
+	for _, s := range registeredScripts() {
+		if _, err := c.Do("SCRIPT", "LOAD", s.src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
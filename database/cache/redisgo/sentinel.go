@@ -0,0 +1,291 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sentinelHealthCheckInterval 订阅哨兵的连接发送 PING 的间隔，超过两个周期没有回复即重新连接
+const sentinelHealthCheckInterval = 10 * time.Second
+
+var (
+	ErrNoMaster    = errors.New("redis: no master found from sentinels")
+	errStaleMaster = errors.New("redis: connection to stale master")
+)
+
+// sentinel 通过哨兵获取当前的主节点地址，并在主从切换后重新解析
+type sentinel struct {
+	masterName string
+	opts       []redis.DialOption
+
+	mu     sync.RWMutex
+	addrs  []string
+	master string
+
+	cancel context.CancelFunc
+}
+
+func newSentinel(o *RedisConfig) *sentinel {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(time.Duration(o.ConnectTimeout) * time.Millisecond),
+		redis.DialReadTimeout(time.Duration(o.ReadTimeout) * time.Millisecond),
+		redis.DialWriteTimeout(time.Duration(o.WriteTimeout) * time.Millisecond),
+	}
+	if len(o.SentinelPassword) != 0 {
+		opts = append(opts, redis.DialPassword(o.SentinelPassword))
+	}
+	opts = append(opts, tlsDialOptions(o)...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &sentinel{
+		masterName: o.MasterName,
+		opts:       opts,
+		addrs:      append([]string(nil), o.SentinelAddrs...),
+		cancel:     cancel,
+	}
+	go s.watch(ctx)
+	return s
+}
+
+func (s *sentinel) close() {
+	s.cancel()
+}
+
+// masterAddr 返回缓存的主节点地址，没有缓存时向哨兵查询
+func (s *sentinel) masterAddr() (string, error) {
+	s.mu.RLock()
+	master := s.master
+	s.mu.RUnlock()
+	if master != "" {
+		return master, nil
+	}
+	return s.resolve()
+}
+
+// resolve 依次询问哨兵，将成功应答的哨兵移到列表首位
+func (s *sentinel) resolve() (string, error) {
+	s.mu.RLock()
+	addrs := append([]string(nil), s.addrs...)
+	s.mu.RUnlock()
+
+	for i, addr := range addrs {
+		master, err := s.queryMaster(addr)
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		s.master = master
+		if i > 0 {
+			s.addrs[0], s.addrs[i] = s.addrs[i], s.addrs[0]
+		}
+		s.mu.Unlock()
+		return master, nil
+	}
+	return "", ErrNoMaster
+}
+
+func (s *sentinel) queryMaster(addr string) (string, error) {
+	c, err := redis.Dial("tcp", addr, s.opts...)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	res, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.masterName))
+	if err != nil {
+		return "", err
+	}
+	if len(res) != 2 {
+		return "", ErrNoMaster
+	}
+	return net.JoinHostPort(res[0], res[1]), nil
+}
+
+// invalidate 清除缓存的主节点地址，下次建立连接时重新查询
+func (s *sentinel) invalidate(addr string) {
+	s.mu.Lock()
+	if addr == "" || s.master == addr {
+		s.master = ""
+	}
+	s.mu.Unlock()
+}
+
+func (s *sentinel) setMaster(addr string) {
+	s.mu.Lock()
+	s.master = addr
+	s.mu.Unlock()
+}
+
+func (s *sentinel) current() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master
+}
+
+// dial 连接主节点并通过 ROLE 确认其仍然是主节点
+func (s *sentinel) dial(options ...redis.DialOption) func() (redis.Conn, error) {
+	return func() (redis.Conn, error) {
+		var lastErr error
+		for i := 0; i < 2; i++ {
+			addr, err := s.masterAddr()
+			if err != nil {
+				return nil, err
+			}
+
+			c, err := redis.Dial("tcp", addr, options...)
+			if err != nil {
+				s.invalidate(addr)
+				lastErr = err
+				continue
+			}
+
+			if !isMaster(c) {
+				c.Close()
+				s.invalidate(addr)
+				lastErr = errStaleMaster
+				continue
+			}
+			return &sentinelConn{Conn: c, addr: addr}, nil
+		}
+		return nil, lastErr
+	}
+}
+
+// testOnBorrow 丢弃连接到旧主节点的空闲连接
+func (s *sentinel) testOnBorrow(next func(c redis.Conn, t time.Time) error) func(c redis.Conn, t time.Time) error {
+	return func(c redis.Conn, t time.Time) error {
+		if sc, ok := c.(*sentinelConn); ok {
+			if master := s.current(); master != "" && sc.addr != master {
+				return errStaleMaster
+			}
+		}
+		if next != nil {
+			return next(c, t)
+		}
+		return nil
+	}
+}
+
+// onError 主节点降级为从节点后写命令会返回 READONLY，此时重新解析主节点
+func (s *sentinel) onError(err error) {
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "READONLY") {
+		s.invalidate("")
+	}
+}
+
+// watch 订阅哨兵的 +switch-master 事件，及时切换主节点
+func (s *sentinel) watch(ctx context.Context) {
+	backoff := subMinBackoff
+	for ctx.Err() == nil {
+		s.mu.RLock()
+		addrs := append([]string(nil), s.addrs...)
+		s.mu.RUnlock()
+
+		for _, addr := range addrs {
+			if s.watchSentinel(ctx, addr) {
+				backoff = subMinBackoff
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > subMaxBackoff {
+			backoff = subMaxBackoff
+		}
+	}
+}
+
+// watchSentinel 返回是否成功订阅过
+func (s *sentinel) watchSentinel(ctx context.Context, addr string) bool {
+	c, err := redis.Dial("tcp", addr, s.opts...)
+	if err != nil {
+		return false
+	}
+	psc := &redis.PubSubConn{Conn: c}
+	defer psc.Close()
+
+	if err := psc.Subscribe("+switch-master"); err != nil {
+		return false
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	// 定时发送 PING，半开的连接上读取会超时，避免错过切换事件
+	go func() {
+		ticker := time.NewTicker(sentinelHealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				psc.Close()
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// 订阅之前可能已经发生了切换
+	s.resolve()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * sentinelHealthCheckInterval).(type) {
+		case redis.Message:
+			// <master name> <old ip> <old port> <new ip> <new port>
+			parts := strings.Fields(string(v.Data))
+			if len(parts) == 5 && parts[0] == s.masterName {
+				s.setMaster(net.JoinHostPort(parts[3], parts[4]))
+			}
+		case error:
+			return true
+		}
+	}
+}
+
+func isMaster(c redis.Conn) bool {
+	values, err := redis.Values(c.Do("ROLE"))
+	if err != nil || len(values) == 0 {
+		return false
+	}
+	role, _ := redis.String(values[0], nil)
+	return role == "master"
+}
+
+// sentinelConn 记录连接的主节点地址，用于丢弃切换前的连接
+type sentinelConn struct {
+	redis.Conn
+	addr string
+}
+
+func (c *sentinelConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *sentinelConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *sentinelConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoContext(c.Conn, ctx, cmd, args...)
+}
+
+func (c *sentinelConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redis.ReceiveContext(c.Conn, ctx)
+}
@@ -0,0 +1,189 @@
+package redisgo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// TestSentinelFailover 设置 REDISGO_TEST_SENTINEL 时启动本地的 redis-server 和 redis-sentinel，
+// 杀掉主节点后客户端应切换到提升后的从节点
+func TestSentinelFailover(t *testing.T) {
+	if os.Getenv("REDISGO_TEST_SENTINEL") == "" {
+		t.Skip("REDISGO_TEST_SENTINEL not set")
+	}
+	for _, bin := range []string{"redis-server", "redis-sentinel"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skip(bin, " not found")
+		}
+	}
+
+	masterPort, replicaPort, sentinelPort := freePort(t), freePort(t), freePort(t)
+	master := startRedis(t, "redis-server", "--port", masterPort, "--save", "", "--appendonly", "no")
+	startRedis(t, "redis-server", "--port", replicaPort, "--save", "", "--appendonly", "no",
+		"--replicaof", "127.0.0.1", masterPort)
+
+	conf := filepath.Join(t.TempDir(), "sentinel.conf")
+	err := os.WriteFile(conf, []byte(fmt.Sprintf("port %s\n"+
+		"sentinel monitor mymaster 127.0.0.1 %s 1\n"+
+		"sentinel down-after-milliseconds mymaster 1000\n"+
+		"sentinel failover-timeout mymaster 5000\n", sentinelPort, masterPort)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startRedis(t, "redis-sentinel", conf)
+
+	waitFor(t, 10*time.Second, "replica sync", func() bool {
+		info, err := redis.String(dialDo(replicaPort, "INFO", "replication"))
+		return err == nil && strings.Contains(info, "master_link_status:up")
+	})
+
+	r := NewRedisgo(WithSentinel("mymaster", "127.0.0.1:"+sentinelPort), WithRetryPolicy(DefaultRetryPolicy(3)))
+	defer r.Close()
+	ctx := context.Background()
+	if _, err := r.Set(ctx, "k", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.sentinel.current(); got != "127.0.0.1:"+masterPort {
+		t.Fatalf("master: got %s, want 127.0.0.1:%s", got, masterPort)
+	}
+	waitFor(t, 10*time.Second, "replication of k", func() bool {
+		v, err := redis.String(dialDo(replicaPort, "GET", "k"))
+		return err == nil && v == "v1"
+	})
+
+	master.Process.Kill()
+	master.Wait()
+
+	waitFor(t, 30*time.Second, "failover", func() bool {
+		return r.sentinel.current() == "127.0.0.1:"+replicaPort
+	})
+	waitFor(t, 10*time.Second, "write to new master", func() bool {
+		_, err := r.Set(ctx, "k", "v2")
+		return err == nil
+	})
+	if v, err := r.GetString(ctx, "k"); err != nil || v != "v2" {
+		t.Fatalf("get: got %q, %v, want v2", v, err)
+	}
+}
+
+// TestReadOnlyInvalidatesMaster pipeline 和事务中返回的 READONLY 同样需要让哨兵重新查询主节点
+func TestReadOnlyInvalidatesMaster(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			return "+OK\r\n"
+		case "EXEC":
+			return "-EXECABORT Transaction discarded because of previous errors.\r\n"
+		}
+		return "-READONLY You can't write against a read only replica.\r\n"
+	})
+	r := NewRedisgo(WithAddr(s.ln.Addr().String()))
+	defer r.Close()
+	r.sentinel = &sentinel{cancel: func() {}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"command", func() error {
+			_, err := r.Set(ctx, "k", "v")
+			return err
+		}},
+		{"pipeline", func() error {
+			p := r.Pipeline(ctx)
+			p.Do("GET", "k")
+			p.Do("SET", "k", "v")
+			return p.Exec()
+		}},
+		{"tx", func() error {
+			return r.Tx(ctx, nil, func(tx *Tx) error {
+				tx.Queue("SET", "k", "v")
+				return nil
+			})
+		}},
+		{"tx do", func() error {
+			return r.Tx(ctx, nil, func(tx *Tx) error {
+				_, err := tx.Do("SET", "k", "v")
+				return err
+			})
+		}},
+	}
+	for _, tt := range tests {
+		r.sentinel.setMaster("127.0.0.1:1")
+		err := tt.run()
+		if e, ok := err.(redis.Error); !ok || !strings.HasPrefix(string(e), "READONLY") {
+			t.Errorf("%s: got %v, want READONLY", tt.name, err)
+		}
+		if got := r.sentinel.current(); got != "" {
+			t.Errorf("%s: master got %s, want invalidated", tt.name, got)
+		}
+	}
+}
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startRedis 启动进程并等待端口可以连接，测试结束时杀掉进程
+func startRedis(t *testing.T, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	port := ""
+	for i, a := range args {
+		if a == "--port" && i+1 < len(args) {
+			port = args[i+1]
+		}
+	}
+	if port == "" {
+		// redis-sentinel 的端口写在配置文件中
+		b, _ := os.ReadFile(args[0])
+		fmt.Sscanf(string(b), "port %s", &port)
+	}
+	waitFor(t, 5*time.Second, name+" start", func() bool {
+		_, err := dialDo(port, "PING")
+		return err == nil
+	})
+	return cmd
+}
+
+func dialDo(port, cmd string, args ...interface{}) (interface{}, error) {
+	c, err := redis.Dial("tcp", "127.0.0.1:"+port, redis.DialConnectTimeout(time.Second), redis.DialReadTimeout(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.Do(cmd, args...)
+}
+
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
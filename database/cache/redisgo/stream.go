@@ -0,0 +1,323 @@
+package redisgo
+
+import (
+	"context"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+	"time"
+)
+
+// XMessage stream 中的一条消息
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XPending XPENDING 返回的待确认消息
+type XPending struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int64
+}
+
+func redisXMessages(reply interface{}, err error) (interface{}, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return []XMessage(nil), err
+	}
+	msgs := make([]XMessage, 0, len(values))
+	for _, v := range values {
+		entry, err := redis.Values(v, nil)
+		if err != nil {
+			return []XMessage(nil), err
+		}
+		if len(entry) != 2 {
+			continue
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return []XMessage(nil), err
+		}
+		// 已被删除的消息 fields 为 nil
+		fields, err := redis.StringMap(entry[1], nil)
+		if err != nil && err != redis.ErrNil {
+			return []XMessage(nil), err
+		}
+		msgs = append(msgs, XMessage{ID: id, Values: fields})
+	}
+	return msgs, nil
+}
+
+// redisXStreamMessages 解析 XREAD/XREADGROUP 的返回，只取第一个 stream
+func redisXStreamMessages(reply interface{}, err error) (interface{}, error) {
+	streams, err := redis.Values(reply, err)
+	if err != nil || len(streams) == 0 {
+		return []XMessage(nil), err
+	}
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil {
+		return []XMessage(nil), err
+	}
+	if len(stream) != 2 {
+		return []XMessage(nil), nil
+	}
+	return redisXMessages(stream[1], nil)
+}
+
+// redisXStreams 解析 XREAD 返回的多个 stream
+func redisXStreams(reply interface{}, err error) (interface{}, error) {
+	streams, err := redis.Values(reply, err)
+	if err != nil {
+		return map[string][]XMessage(nil), err
+	}
+	res := make(map[string][]XMessage, len(streams))
+	for _, s := range streams {
+		stream, err := redis.Values(s, nil)
+		if err != nil {
+			return map[string][]XMessage(nil), err
+		}
+		if len(stream) != 2 {
+			continue
+		}
+		name, err := redis.String(stream[0], nil)
+		if err != nil {
+			return map[string][]XMessage(nil), err
+		}
+		msgs, err := redisXMessages(stream[1], nil)
+		if err != nil {
+			return map[string][]XMessage(nil), err
+		}
+		res[name] = msgs.([]XMessage)
+	}
+	return res, nil
+}
+
+func redisXPending(reply interface{}, err error) (interface{}, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return []XPending(nil), err
+	}
+	res := make([]XPending, 0, len(values))
+	for _, v := range values {
+		var p XPending
+		var idle int64
+		entry, err := redis.Values(v, nil)
+		if err != nil {
+			return []XPending(nil), err
+		}
+		if _, err := redis.Scan(entry, &p.ID, &p.Consumer, &idle, &p.Deliveries); err != nil {
+			return []XPending(nil), err
+		}
+		p.Idle = time.Duration(idle) * time.Millisecond
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// XAdd 追加消息，id 由服务端生成
+func (r *Redisgo) XAdd(ctx context.Context, stream string, fields ...interface{}) (id string, err error) {
+	var reply interface{}
+	args := []interface{}{stream, "*"}
+	args = append(args, fields...)
+	reply, err = r.do(ctx, "XADD", redisString, args...)
+	if err != nil {
+		return
+	}
+	id = reply.(string)
+	return
+}
+
+// XAddMaxLen 追加消息并将 stream 近似裁剪到 maxLen 条
+func (r *Redisgo) XAddMaxLen(ctx context.Context, stream string, maxLen int64, fields ...interface{}) (id string, err error) {
+	var reply interface{}
+	args := []interface{}{stream, "MAXLEN", "~", maxLen, "*"}
+	args = append(args, fields...)
+	reply, err = r.do(ctx, "XADD", redisString, args...)
+	if err != nil {
+		return
+	}
+	id = reply.(string)
+	return
+}
+
+// XRange 返回 [start, end] 区间的消息，count 小于等于 0 时不限制条数
+func (r *Redisgo) XRange(ctx context.Context, stream, start, end string, count int64) (res []XMessage, err error) {
+	var reply interface{}
+	args := []interface{}{stream, start, end}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	reply, err = r.do(ctx, "XRANGE", redisXMessages, args...)
+	if err != nil {
+		return
+	}
+	res = reply.([]XMessage)
+	return
+}
+
+func (r *Redisgo) XLen(ctx context.Context, stream string) (res int64, err error) {
+	var reply interface{}
+	reply, err = r.do(ctx, "XLEN", redisInt64, stream)
+	if err != nil {
+		return
+	}
+	res = reply.(int64)
+	return
+}
+
+// XTrim 将 stream 裁剪到 maxLen 条，approx 为 true 时使用 ~ 近似裁剪，性能更好
+func (r *Redisgo) XTrim(ctx context.Context, stream string, maxLen int64, approx bool) (res int64, err error) {
+	var reply interface{}
+	args := []interface{}{stream, "MAXLEN"}
+	if approx {
+		args = append(args, "~")
+	}
+	args = append(args, maxLen)
+	reply, err = r.do(ctx, "XTRIM", redisInt64, args...)
+	if err != nil {
+		return
+	}
+	res = reply.(int64)
+	return
+}
+
+func (r *Redisgo) XDel(ctx context.Context, stream string, ids ...string) (res int64, err error) {
+	var reply interface{}
+	args := []interface{}{stream}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	reply, err = r.do(ctx, "XDEL", redisInt64, args...)
+	if err != nil {
+		return
+	}
+	res = reply.(int64)
+	return
+}
+
+// XGroupCreate 创建消费组，stream 不存在时自动创建，消费组已存在时不返回错误
+func (r *Redisgo) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	_, err := r.do(ctx, "XGROUP", nil, "CREATE", stream, group, start, "MKSTREAM")
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+func (r *Redisgo) XAck(ctx context.Context, stream, group string, ids ...string) (res int64, err error) {
+	var reply interface{}
+	args := []interface{}{stream, group}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	reply, err = r.do(ctx, "XACK", redisInt64, args...)
+	if err != nil {
+		return
+	}
+	res = reply.(int64)
+	return
+}
+
+// XReadGroup 以消费组的方式读取新消息，block 大于 0 时最多阻塞 block，超时返回空
+func (r *Redisgo) XReadGroup(ctx context.Context, group, consumer, stream string, count int64, block time.Duration) (res []XMessage, err error) {
+	var reply interface{}
+	args := []interface{}{"GROUP", group, consumer}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if block > 0 {
+		args = append(args, "BLOCK", block.Milliseconds())
+	}
+	args = append(args, "STREAMS", stream, ">")
+	if block > 0 {
+		reply, err = r.doBlocking(ctx, block, "XREADGROUP", redisXStreamMessages, args...)
+	} else {
+		reply, err = r.do(ctx, "XREADGROUP", redisXStreamMessages, args...)
+	}
+	if err != nil {
+		return
+	}
+	res = reply.([]XMessage)
+	return
+}
+
+// XRead 读取 streams 中 id 之后的消息，streams 为 stream 到起始 id 的映射，id 为 "$" 时只读取新消息
+// block 大于 0 时最多阻塞 block，超时返回空，阻塞期间 ctx 取消时立即返回 ctx.Err()
+// 集群模式下所有 stream 需要在同一个 slot
+func (r *Redisgo) XRead(ctx context.Context, streams map[string]string, count int64, block time.Duration) (res map[string][]XMessage, err error) {
+	var reply interface{}
+	args := make([]interface{}, 0, 2*len(streams)+5)
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	if block > 0 {
+		args = append(args, "BLOCK", block.Milliseconds())
+	}
+	args = append(args, "STREAMS")
+	ids := make([]interface{}, 0, len(streams))
+	for stream, id := range streams {
+		args = append(args, stream)
+		ids = append(ids, id)
+	}
+	args = append(args, ids...)
+
+	if block > 0 {
+		reply, err = r.doBlocking(ctx, block, "XREAD", redisXStreams, args...)
+	} else {
+		reply, err = r.do(ctx, "XREAD", redisXStreams, args...)
+	}
+	if err != nil {
+		return
+	}
+	res = reply.(map[string][]XMessage)
+	return
+}
+
+// XPendingIdle 从 start 开始返回最多 count 条空闲时间超过 minIdle 的待确认消息
+// start 为 "-" 时从头开始，翻页时传入 "(" 加上一页最后一条的 id
+func (r *Redisgo) XPendingIdle(ctx context.Context, stream, group string, minIdle time.Duration, start string, count int64) (res []XPending, err error) {
+	var reply interface{}
+	reply, err = r.do(ctx, "XPENDING", redisXPending, stream, group, "IDLE", minIdle.Milliseconds(), start, "+", count)
+	if err != nil {
+		return
+	}
+	res = reply.([]XPending)
+	return
+}
+
+// XClaimJustID 将 ids 中空闲时间超过 minIdle 的待确认消息转移给 consumer 并重置空闲时间，不增加投递次数，返回转移成功的 id
+func (r *Redisgo) XClaimJustID(ctx context.Context, stream, group, consumer string, minIdle time.Duration, ids ...string) (res []string, err error) {
+	var reply interface{}
+	args := []interface{}{stream, group, consumer, minIdle.Milliseconds()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, "JUSTID")
+	reply, err = r.do(ctx, "XCLAIM", redisStrings, args...)
+	if err != nil {
+		return
+	}
+	res, _ = reply.([]string)
+	return
+}
+
+// XAutoClaim 将空闲时间超过 minIdle 的待确认消息转移给 consumer，返回下一次扫描的起始 id
+func (r *Redisgo) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) (res []XMessage, next string, err error) {
+	values, err := redis.Values(r.do(ctx, "XAUTOCLAIM", nil, stream, group, consumer, minIdle.Milliseconds(), start, "COUNT", count))
+	if err == redis.ErrNil {
+		err = nil
+	}
+	if err != nil || len(values) < 2 {
+		return
+	}
+	if next, err = redis.String(values[0], nil); err != nil {
+		return
+	}
+	reply, err := redisXMessages(values[1], nil)
+	if err != nil {
+		return
+	}
+	res = reply.([]XMessage)
+	return
+}
@@ -0,0 +1,290 @@
+package redisgo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// streamMinBackoff 读取失败或没有阻塞时间时再次读取前的最短等待时间
+const streamMinBackoff = 100 * time.Millisecond
+
+// streamDeadLetterScript 消息仍未确认且投递次数达到上限时复制到死信队列并确认，两步在同一个脚本中完成
+// 已被删除的消息只确认
+var streamDeadLetterScript = NewScript(2, `
+local p = redis.call("XPENDING", KEYS[1], ARGV[1], ARGV[2], ARGV[2], 1)
+if #p == 0 or p[1][4] < tonumber(ARGV[3]) then
+	return 0
+end
+local msgs = redis.call("XRANGE", KEYS[1], ARGV[2], ARGV[2])
+if #msgs > 0 then
+	local fields = {"_id", ARGV[2], "_consumer", p[1][2], "_deliveries", p[1][4]}
+	for _, v in ipairs(msgs[1][2]) do
+		fields[#fields + 1] = v
+	end
+	redis.call("XADD", KEYS[2], "*", unpack(fields))
+end
+return redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// StreamHandler 处理一条消息，返回 nil 时消息被 XACK，否则留在 pending 列表中等待重新投递
+type StreamHandler func(ctx context.Context, msg XMessage) error
+
+type streamConsumerOptions struct {
+	concurrency   int
+	count         int64
+	block         time.Duration
+	minIdle       time.Duration
+	claimInterval time.Duration
+	maxDeliveries int64
+	deadLetter    string
+	startID       string
+}
+
+type StreamConsumerOption func(*streamConsumerOptions)
+
+// WithStreamConcurrency 同时处理消息的协程数
+func WithStreamConcurrency(n int) StreamConsumerOption {
+	return func(o *streamConsumerOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithStreamCount 每次 XREADGROUP 读取的消息数
+func WithStreamCount(count int64) StreamConsumerOption {
+	return func(o *streamConsumerOptions) {
+		o.count = count
+	}
+}
+
+// WithStreamBlock XREADGROUP 的阻塞时间，也决定了关闭时的最长等待时间，为 0 时不阻塞，没有消息时等待 100ms 再读取
+func WithStreamBlock(block time.Duration) StreamConsumerOption {
+	return func(o *streamConsumerOptions) {
+		o.block = block
+	}
+}
+
+// WithStreamClaim 每隔 interval 认领空闲超过 minIdle 的待确认消息，用于接管已退出消费者的消息
+// 本地正在处理的消息每个 interval 重置一次空闲时间，minIdle 应大于 interval
+func WithStreamClaim(minIdle, interval time.Duration) StreamConsumerOption {
+	return func(o *streamConsumerOptions) {
+		o.minIdle = minIdle
+		o.claimInterval = interval
+	}
+}
+
+// WithStreamDeadLetter 投递次数达到 maxDeliveries 的消息转移到 stream 死信队列并确认
+// 集群模式下死信队列需要与消费的 stream 使用相同的 hash tag，例如 "{orders}" 和 "{orders}:dead"
+func WithStreamDeadLetter(stream string, maxDeliveries int64) StreamConsumerOption {
+	return func(o *streamConsumerOptions) {
+		o.deadLetter = stream
+		o.maxDeliveries = maxDeliveries
+	}
+}
+
+// WithStreamStartID 创建消费组时的起始 id，默认为 "$" 只消费新消息
+func WithStreamStartID(id string) StreamConsumerOption {
+	return func(o *streamConsumerOptions) {
+		o.startID = id
+	}
+}
+
+// StreamConsumer 消费组的消费者
+type StreamConsumer struct {
+	r        *Redisgo
+	stream   string
+	group    string
+	consumer string
+	handler  StreamHandler
+	opts     streamConsumerOptions
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	// inflight 本地正在处理的消息 id
+	mu       sync.Mutex
+	inflight map[string]struct{}
+}
+
+func NewStreamConsumer(r *Redisgo, stream, group, consumer string, handler StreamHandler, opts ...StreamConsumerOption) *StreamConsumer {
+	o := streamConsumerOptions{
+		concurrency:   1,
+		count:         10,
+		block:         2 * time.Second,
+		minIdle:       time.Minute,
+		claimInterval: 30 * time.Second,
+		maxDeliveries: 5,
+		deadLetter:    stream + ":dead",
+		startID:       "$",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency <= 0 {
+		o.concurrency = 1
+	}
+
+	return &StreamConsumer{
+		r:        r,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+		handler:  handler,
+		opts:     o,
+		sem:      make(chan struct{}, o.concurrency),
+		inflight: make(map[string]struct{}),
+	}
+}
+
+// Run 创建消费组并开始消费，阻塞直到 ctx 结束，返回前等待处理中的消息完成
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	if err := c.r.XGroupCreate(ctx, c.stream, c.group, c.opts.startID); err != nil {
+		return err
+	}
+	defer c.wg.Wait()
+
+	claim := time.NewTicker(c.opts.claimInterval)
+	defer claim.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-claim.C:
+			c.claim(ctx)
+		default:
+		}
+
+		msgs, err := c.r.XReadGroup(ctx, c.group, c.consumer, c.stream, c.opts.count, c.opts.block)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// 读取失败时等待一个阻塞周期再重试，避免空转
+			if !c.wait(ctx, c.opts.block) {
+				return nil
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			c.dispatch(ctx, msg)
+		}
+		// 不阻塞读取时没有消息会立即返回
+		if len(msgs) == 0 && c.opts.block <= 0 && !c.wait(ctx, 0) {
+			return nil
+		}
+	}
+}
+
+// wait 至少等待 streamMinBackoff，ctx 结束时返回 false
+func (c *StreamConsumer) wait(ctx context.Context, d time.Duration) bool {
+	if d < streamMinBackoff {
+		d = streamMinBackoff
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// dispatch 本地已经在处理的消息不会重复处理
+func (c *StreamConsumer) dispatch(ctx context.Context, msg XMessage) {
+	c.mu.Lock()
+	if _, ok := c.inflight[msg.ID]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[msg.ID] = struct{}{}
+	c.mu.Unlock()
+
+	c.sem <- struct{}{}
+	c.wg.Add(1)
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.inflight, msg.ID)
+			c.mu.Unlock()
+			<-c.sem
+			c.wg.Done()
+		}()
+
+		if err := c.handler(ctx, msg); err != nil {
+			return
+		}
+		// ctx 结束后仍需确认已处理完的消息
+		actx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		c.r.XAck(actx, c.stream, c.group, msg.ID)
+	}()
+}
+
+// claim 先重置本地正在处理的消息的空闲时间，避免被当作已退出消费者的消息认领，
+// 再将超过最大投递次数的消息转入死信队列，最后认领其余空闲的待确认消息
+func (c *StreamConsumer) claim(ctx context.Context) {
+	c.touch(ctx)
+
+	// 按页遍历全部空闲的待确认消息，不只检查第一页
+	for start := "-"; c.opts.maxDeliveries > 0; {
+		pending, err := c.r.XPendingIdle(ctx, c.stream, c.group, c.opts.minIdle, start, c.opts.count)
+		if err != nil {
+			return
+		}
+		for _, p := range pending {
+			if p.Deliveries >= c.opts.maxDeliveries && !c.isInflight(p.ID) {
+				c.deadLetter(ctx, p.ID)
+			}
+		}
+		if int64(len(pending)) < c.opts.count || ctx.Err() != nil {
+			break
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+
+	start := "0-0"
+	for {
+		msgs, next, err := c.r.XAutoClaim(ctx, c.stream, c.group, c.consumer, c.opts.minIdle, start, c.opts.count)
+		if err != nil {
+			return
+		}
+		for _, msg := range msgs {
+			// 已被删除的消息无法处理，直接确认
+			if msg.Values == nil {
+				c.r.XAck(ctx, c.stream, c.group, msg.ID)
+				continue
+			}
+			c.dispatch(ctx, msg)
+		}
+		if next == "" || next == "0-0" || ctx.Err() != nil {
+			return
+		}
+		start = next
+	}
+}
+
+// touch 通过 XCLAIM JUSTID 重置本地正在处理的消息的空闲时间，不增加投递次数
+func (c *StreamConsumer) touch(ctx context.Context) {
+	c.mu.Lock()
+	ids := make([]string, 0, len(c.inflight))
+	for id := range c.inflight {
+		ids = append(ids, id)
+	}
+	c.mu.Unlock()
+	if len(ids) > 0 {
+		c.r.XClaimJustID(ctx, c.stream, c.group, c.consumer, 0, ids...)
+	}
+}
+
+func (c *StreamConsumer) isInflight(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.inflight[id]
+	return ok
+}
+
+func (c *StreamConsumer) deadLetter(ctx context.Context, id string) {
+	streamDeadLetterScript.Do(ctx, c.r, c.stream, c.opts.deadLetter, c.group, id, c.opts.maxDeliveries)
+}
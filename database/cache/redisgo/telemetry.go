@@ -0,0 +1,267 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	instrumentationName = "github.com/aloeproject/toolbox/database/cache/redisgo"
+	// db.statement 中最多记录的参数个数
+	maxStatementArgs = 16
+)
+
+// telemetry 为每个命令创建 span，并记录耗时和错误次数
+type telemetry struct {
+	tracer   trace.Tracer
+	meter    metric.Meter
+	duration syncfloat64.Histogram
+	errors   syncint64.Counter
+	attrs    []attribute.KeyValue
+	pool     *poolObserver
+}
+
+// poolObserver 连接池指标回调引用的客户端
+// 当前版本的 metric API 不能注销回调，Close 时清空 r，之后回调不再上报，客户端也可以被回收
+type poolObserver struct {
+	mu sync.RWMutex
+	r  *Redisgo
+}
+
+func newTelemetry(o *RedisConfig) *telemetry {
+	tp := o.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	mp := o.MeterProvider
+	if mp == nil {
+		mp = global.MeterProvider()
+	}
+
+	t := &telemetry{
+		tracer: tp.Tracer(instrumentationName),
+		meter:  mp.Meter(instrumentationName),
+		attrs:  []attribute.KeyValue{semconv.DBSystemRedis},
+	}
+	if len(o.ClusterAddrs) == 0 {
+		t.attrs = append(t.attrs, semconv.DBRedisDBIndexKey.Int(o.Database))
+	}
+
+	// 指标创建失败时 otel 会返回可以正常调用的空实现
+	t.duration, _ = t.meter.SyncFloat64().Histogram("db.client.redis.duration",
+		instrument.WithUnit(unit.Milliseconds), instrument.WithDescription("redis command duration"))
+	t.errors, _ = t.meter.SyncInt64().Counter("db.client.redis.errors",
+		instrument.WithDescription("redis command errors"))
+	return t
+}
+
+// registerPoolMetrics 按节点地址上报连接池状态，需要在连接池创建之后调用
+func (t *telemetry) registerPoolMetrics(r *Redisgo) {
+	meter := t.meter
+	active, err1 := meter.AsyncInt64().Gauge("db.client.redis.connections.active",
+		instrument.WithDescription("active connections in the pool"))
+	idle, err2 := meter.AsyncInt64().Gauge("db.client.redis.connections.idle",
+		instrument.WithDescription("idle connections in the pool"))
+	waitCount, err3 := meter.AsyncInt64().Counter("db.client.redis.connections.wait_count",
+		instrument.WithDescription("total number of connections waited for"))
+	waitDuration, err4 := meter.AsyncInt64().Counter("db.client.redis.connections.wait_duration",
+		instrument.WithUnit(unit.Milliseconds), instrument.WithDescription("total time waited for new connections"))
+	for _, err := range []error{err1, err2, err3, err4} {
+		if err != nil {
+			otel.Handle(err)
+			return
+		}
+	}
+
+	t.pool = &poolObserver{r: r}
+	observer := t.pool
+	err := meter.RegisterCallback([]instrument.Asynchronous{active, idle, waitCount, waitDuration}, func(ctx context.Context) {
+		observer.mu.RLock()
+		r := observer.r
+		observer.mu.RUnlock()
+		if r == nil {
+			return
+		}
+		for addr, s := range r.PoolStats() {
+			attrs := append([]attribute.KeyValue{semconv.DBSystemRedis}, peerAttrs(addr)...)
+			active.Observe(ctx, int64(s.ActiveCount), attrs...)
+			idle.Observe(ctx, int64(s.IdleCount), attrs...)
+			waitCount.Observe(ctx, s.WaitCount, attrs...)
+			waitDuration.Observe(ctx, s.WaitDuration.Milliseconds(), attrs...)
+		}
+	})
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// close 停止上报连接池指标
+func (t *telemetry) close() {
+	if t.pool == nil {
+		return
+	}
+	t.pool.mu.Lock()
+	t.pool.r = nil
+	t.pool.mu.Unlock()
+}
+
+// start 创建命令的 span，statement 中只保留 key，其余参数以 ? 代替，span 未被采样时不生成 statement
+func (t *telemetry) start(ctx context.Context, cmd string, args []interface{}) (context.Context, trace.Span) {
+	op := strings.ToUpper(cmd)
+	attrs := make([]attribute.KeyValue, 0, len(t.attrs)+1)
+	attrs = append(attrs, t.attrs...)
+	attrs = append(attrs, semconv.DBOperationKey.String(op))
+	ctx, span := t.tracer.Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	if span.IsRecording() {
+		span.SetAttributes(semconv.DBStatementKey.String(sanitizeCommand(op, args)))
+	}
+	return ctx, span
+}
+
+// startPipeline 为 pipeline 或事务创建一个 span，statement 为所有命令，每行一条
+func (t *telemetry) startPipeline(ctx context.Context, op string, cmds []*pipeCmd) (context.Context, trace.Span) {
+	attrs := make([]attribute.KeyValue, 0, len(t.attrs)+2)
+	attrs = append(attrs, t.attrs...)
+	attrs = append(attrs, semconv.DBOperationKey.String(op), attribute.Int("db.redis.num_cmd", len(cmds)))
+	ctx, span := t.tracer.Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	if span.IsRecording() {
+		lines := make([]string, 0, len(cmds))
+		for _, c := range cmds {
+			lines = append(lines, sanitizeCommand(strings.ToUpper(c.name), c.args))
+		}
+		span.SetAttributes(semconv.DBStatementKey.String(strings.Join(lines, "\n")))
+	}
+	return ctx, span
+}
+
+// end 结束 span 并记录耗时，出错时按错误类型计数
+func (t *telemetry) end(ctx context.Context, span trace.Span, op string, start time.Time, err error) {
+	attrs := []attribute.KeyValue{semconv.DBSystemRedis, semconv.DBOperationKey.String(op)}
+	t.duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), attrs...)
+	if err != nil {
+		t.errors.Add(ctx, 1, append(attrs, attribute.String("error.kind", errorKind(err)))...)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setPeer 记录命令实际执行的节点
+func setPeer(ctx context.Context, addr string) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(peerAttrs(addr)...)
+}
+
+func peerAttrs(addr string) []attribute.KeyValue {
+	for _, prefix := range []string{"rediss://", "redis://", "unix://"} {
+		addr = strings.TrimPrefix(addr, prefix)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []attribute.KeyValue{semconv.NetPeerNameKey.String(addr)}
+	}
+	attrs := []attribute.KeyValue{semconv.NetPeerNameKey.String(host)}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.NetPeerPortKey.Int(p))
+	}
+	return attrs
+}
+
+// sanitizeCommand 生成 "SET user:1 ?" 形式的语句，避免把缓存的值写入 trace
+func sanitizeCommand(cmd string, args []interface{}) string {
+	isKey := make(map[int]bool)
+	idx, _ := commandKeyIndexes(cmd, args)
+	for _, i := range idx {
+		isKey[i] = true
+	}
+
+	var b strings.Builder
+	b.WriteString(cmd)
+	for i, a := range args {
+		if i >= maxStatementArgs {
+			b.WriteString(" ...")
+			break
+		}
+		b.WriteByte(' ')
+		if isKey[i] {
+			b.WriteString(keyString(a))
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// errorKind 错误分类，作为错误计数的维度
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), err == ErrTimeout:
+		return "timeout"
+	case err == ErrConnExhausted:
+		return "pool_exhausted"
+	case err == ErrCircuitOpen:
+		return "circuit_open"
+	}
+	if e, ok := err.(redis.Error); ok {
+		// 服务端错误的第一个单词为错误类型，如 WRONGTYPE、MOVED
+		if kind := strings.Fields(string(e)); len(kind) > 0 {
+			return kind[0]
+		}
+		return "ERR"
+	}
+	return "network"
+}
+
+// PoolStats 返回每个节点连接池的状态，key 为节点地址
+func (r *Redisgo) PoolStats() map[string]redis.PoolStats {
+	stats := make(map[string]redis.PoolStats)
+	if r.cluster != nil {
+		r.cluster.mu.RLock()
+		for addr, p := range r.cluster.pools {
+			stats[addr] = p.Stats()
+		}
+		r.cluster.mu.RUnlock()
+		return stats
+	}
+
+	stats[r.masterAddr()] = r.pool.Stats()
+	if r.replicas != nil {
+		for _, n := range r.replicas.nodes {
+			stats[n.addr] = n.pool.Stats()
+		}
+	}
+	return stats
+}
+
+// masterAddr 哨兵模式下为当前主节点地址，否则为配置的地址
+func (r *Redisgo) masterAddr() string {
+	if r.sentinel != nil {
+		if addr := r.sentinel.current(); addr != "" {
+			return addr
+		}
+		return r.opts.MasterName
+	}
+	return r.opts.Addr
+}
@@ -0,0 +1,62 @@
+package redisgo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"net"
+	"os"
+	"strings"
+)
+
+// tlsDialOptions 根据配置生成 TLS 相关的连接选项
+// 证书加载失败时每次建立连接都会返回该错误
+func tlsDialOptions(o *RedisConfig) []redis.DialOption {
+	if !o.TLS && !strings.HasPrefix(o.Addr, "rediss://") {
+		return nil
+	}
+
+	conf, err := buildTLSConfig(o)
+	if err != nil {
+		return []redis.DialOption{redis.DialNetDial(func(network, addr string) (net.Conn, error) {
+			return nil, err
+		})}
+	}
+
+	opts := []redis.DialOption{redis.DialTLSConfig(conf), redis.DialTLSSkipVerify(o.TLSInsecureSkipVerify)}
+	if o.TLS {
+		opts = append(opts, redis.DialUseTLS(true))
+	}
+	return opts
+}
+
+func buildTLSConfig(o *RedisConfig) (*tls.Config, error) {
+	if o.TLSConfig != nil {
+		return o.TLSConfig, nil
+	}
+
+	conf := &tls.Config{
+		ServerName:         o.TLSServerName,
+		InsecureSkipVerify: o.TLSInsecureSkipVerify,
+	}
+	if o.TLSCAFile != "" {
+		pem, err := os.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("redis: no certificates found in " + o.TLSCAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if o.TLSCertFile != "" || o.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
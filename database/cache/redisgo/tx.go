@@ -0,0 +1,188 @@
+package redisgo
+
+import (
+	"context"
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTxFailed WATCH 的 key 被其他客户端修改，且重试次数用尽
+	ErrTxFailed = errors.New("redis: transaction failed, watched key changed")
+)
+
+// Tx 乐观锁事务，WATCH 之后所有操作都在同一个连接上执行
+// 通过 Do 可以立即执行读命令，通过 Set、HSet 等方法加入的命令在 MULTI/EXEC 中原子执行
+type Tx struct {
+	cmdQueue
+	ctx    context.Context
+	r      *Redisgo
+	client redis.Conn
+}
+
+// Do 在事务连接上立即执行命令，通常用于读取 WATCH 的 key
+func (tx *Tx) Do(cmd string, args ...interface{}) (reply interface{}, err error) {
+	args, f, err := tx.r.prefixCommand(cmd, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := tx.r.telemetry.start(tx.ctx, cmd, args)
+	defer func(start time.Time) {
+		tx.r.telemetry.end(ctx, span, strings.ToUpper(cmd), start, err)
+	}(time.Now())
+
+	return tx.r.processHooks(ctx, cmd, args, func(ctx context.Context, cmd string, args []interface{}) (interface{}, error) {
+		reply, err := redis.DoContext(tx.client, ctx, cmd, args...)
+		tx.r.onError(err)
+		if f != nil {
+			reply, err = f(reply, err)
+		}
+		if err == redis.ErrNil {
+			err = nil
+		}
+		return reply, err
+	})
+}
+
+// Queue 将命令加入事务队列，返回原始的 reply
+func (tx *Tx) Queue(cmd string, args ...interface{}) *PipeResult[interface{}] {
+	return tx.cmdQueue.Do(cmd, args...)
+}
+
+// Unwatch 放弃本次事务，回调返回 nil 时不再执行 EXEC
+func (tx *Tx) Unwatch() error {
+	tx.cmds = nil
+	_, err := tx.Do("UNWATCH")
+	return err
+}
+
+// Tx 执行乐观锁事务: WATCH watchKeys 后调用 fn，fn 读取数据并加入写命令，随后执行 MULTI/EXEC
+// 如果 EXEC 因为 watch 的 key 被修改而失败，会重新执行 fn，最多重试 TxRetry 次，仍失败则返回 ErrTxFailed
+// fn 返回错误时事务不会提交
+func (r *Redisgo) Tx(ctx context.Context, watchKeys []string, fn func(tx *Tx) error) error {
+	var (
+		count = 0
+	)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		committed, err := r.tx(ctx, watchKeys, fn)
+		if err != nil {
+			return err
+		}
+		if committed {
+			return nil
+		}
+		if count >= r.opts.TxRetry {
+			return ErrTxFailed
+		}
+		count++
+	}
+}
+
+func (r *Redisgo) tx(ctx context.Context, watchKeys []string, fn func(tx *Tx) error) (committed bool, err error) {
+	var key string
+	if len(watchKeys) > 0 {
+		key = r.prefix + watchKeys[0]
+	} else if r.cluster != nil {
+		return false, ErrClusterNeedKeySlot
+	}
+	client, err := r.conn(ctx, key)
+	if err != nil {
+		return false, convertErr(err)
+	}
+	defer client.Close()
+
+	tx := &Tx{ctx: ctx, r: r, client: client}
+	if len(watchKeys) > 0 {
+		args := make([]interface{}, 0, len(watchKeys))
+		for _, k := range watchKeys {
+			args = append(args, k)
+		}
+		if _, err = tx.Do("WATCH", args...); err != nil {
+			return false, convertErr(err)
+		}
+	}
+
+	if err = fn(tx); err != nil {
+		return false, err
+	}
+	if len(tx.cmds) == 0 {
+		return true, nil
+	}
+
+	if err = r.prefixCmds(tx.cmds); err != nil {
+		return false, err
+	}
+	ctx, span := r.telemetry.startPipeline(ctx, "MULTI", tx.cmds)
+	defer func(start time.Time) {
+		r.telemetry.end(ctx, span, "MULTI", start, err)
+	}(time.Now())
+
+	err = r.processPipelineHooks(ctx, tx.cmds, func(ctx context.Context) (err error) {
+		gen, err := r.breaker.allow()
+		if err != nil {
+			setCmdsErr(tx.cmds, err)
+			return err
+		}
+		begin := time.Now()
+		committed, err = execTx(ctx, client, tx.cmds)
+		r.breaker.done(gen, err, time.Since(begin))
+		// 命令入队时返回的 READONLY 由 EXEC 带回
+		r.onError(err)
+		return err
+	})
+	return committed, err
+}
+
+// execTx 在 MULTI/EXEC 中执行命令，watch 的 key 被修改时返回 committed 为 false
+func execTx(ctx context.Context, client redis.Conn, cmds []*pipeCmd) (committed bool, err error) {
+	if err = client.Send("MULTI"); err != nil {
+		return false, convertErr(err)
+	}
+	for _, c := range cmds {
+		if err = client.Send(c.name, c.args...); err != nil {
+			return false, convertErr(err)
+		}
+	}
+
+	reply, err := redis.DoContext(client, ctx, "EXEC")
+	if err == redis.ErrNil || (err == nil && reply == nil) {
+		return false, nil
+	}
+	if err != nil {
+		err = convertErr(err)
+		setCmdsErr(cmds, err)
+		return false, err
+	}
+
+	replies, err := redis.Values(reply, nil)
+	if err != nil {
+		return false, err
+	}
+	for i, c := range cmds {
+		var (
+			rp   interface{}
+			rerr error
+		)
+		if i < len(replies) {
+			rp = replies[i]
+			if e, ok := rp.(redis.Error); ok {
+				rp, rerr = nil, e
+			}
+		}
+		if c.f != nil {
+			rp, rerr = c.f(rp, rerr)
+		}
+		if rerr == redis.ErrNil {
+			rerr = nil
+		}
+		c.reply, c.err = rp, rerr
+	}
+	return true, nil
+}